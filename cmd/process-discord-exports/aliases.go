@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/aliases"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+func aliasesFilePath() string {
+	if len(aliasesPath) > 0 {
+		return aliasesPath
+	}
+	return filepath.Join(exportsPath, "aliases.yml")
+}
+
+// importAliases records all names from the alias file as observations, so
+// they are known before any export gets processed.
+func (p *Processor) importAliases() error {
+	path := aliasesFilePath()
+	list, err := aliases.Load(path)
+	if err != nil {
+		return err
+	}
+
+	// aliases from a previous import, e.g. if users were kept on reset, keep
+	// their IDs so that observations stay in the order they were made
+	var previous []database.UserNameObservation
+	if tx := p.db.GORM().
+		Where("source = ?", database.ObservationSourceAlias).
+		Find(&previous); tx.Error != nil {
+		return tx.Error
+	}
+	type aliasKey struct {
+		userID, name string
+		from         int64
+	}
+	stale := map[aliasKey]database.UserNameObservation{}
+	for _, observation := range previous {
+		stale[aliasKey{observation.UserID, observation.Name, observation.Time.UnixNano()}] = observation
+	}
+
+	for _, alias := range list {
+		if _, ok := p.forgottenAccount(alias.UserID); ok {
+			log.Printf("WARNING: Ignoring alias %s of a forgotten user", alias)
+			continue
+		}
+		user, err := p.lookupUserID(alias.UserID)
+		if err != nil {
+			return err
+		}
+		key := aliasKey{user.ID, alias.Name, alias.From.UnixNano()}
+		observation, ok := stale[key]
+		delete(stale, key)
+		if !ok {
+			observation = database.UserNameObservation{
+				UserID: user.ID,
+				Name:   alias.Name,
+				Kind:   database.NameKindUsername,
+				Time:   alias.From,
+				Source: database.ObservationSourceAlias,
+			}
+		}
+		observation.ValidUntil = alias.Until
+		observation.Note = alias.Note
+		if tx := p.db.GORM().Save(&observation); tx.Error != nil {
+			return tx.Error
+		}
+	}
+
+	// whatever was removed from the alias file
+	for _, observation := range stale {
+		if tx := p.db.GORM().Delete(&observation); tx.Error != nil {
+			return tx.Error
+		}
+	}
+	if len(list) > 0 {
+		log.Printf("Loaded %d aliases from %s", len(list), path)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/export"
+)
+
+// exportSchemaFile is written next to the exported files and describes them.
+const exportSchemaFile = "schema.json"
+
+type exportedRelation struct {
+	database.Relation
+	File string `json:"file"`
+	Rows int    `json:"rows"`
+}
+
+type exportSchema struct {
+	Format        string             `json:"format"`
+	SchemaVersion int                `json:"schema_version"`
+	Tables        []exportedRelation `json:"tables"`
+}
+
+func runExport(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", export.FormatCSV, "csv, jsonl or parquet")
+	outputDir := flags.String("output-dir", "", "DIRPATH")
+	views := flags.Bool("views", false, "also export the views")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*outputDir) == 0 {
+		return errors.New("need an output directory via --output-dir")
+	}
+
+	schemaVersion, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	relations, err := db.Relations(*views)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		return err
+	}
+
+	schema := exportSchema{
+		Format:        *format,
+		SchemaVersion: schemaVersion,
+		Tables:        []exportedRelation{},
+	}
+	for _, relation := range relations {
+		exported, err := exportRelation(db, *outputDir, *format, relation)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %d rows of %s", exported.Rows, relation.Name)
+		schema.Tables = append(schema.Tables, *exported)
+	}
+
+	f, err := os.Create(filepath.Join(*outputDir, exportSchemaFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func exportRelation(db *database.Database, dir, format string, relation database.Relation) (*exportedRelation, error) {
+	exported := &exportedRelation{
+		Relation: relation,
+		File:     relation.Name + export.Extension(format),
+	}
+	f, err := os.Create(filepath.Join(dir, exported.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w, err := export.NewWriter(format, f, relation)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ReadRelation(relation, func(row []any) error {
+		exported.Rows++
+		return w.WriteRow(row)
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return exported, f.Close()
+}
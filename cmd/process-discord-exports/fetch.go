@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/discord"
+)
+
+// clientFlags are the flags shared by all subcommands talking to Discord.
+type clientFlags struct {
+	baseURL *string
+	token   *string
+	bot     *bool
+}
+
+func addClientFlags(flags *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		baseURL: flags.String("base-url", discord.DefaultAPIBaseURL, "`URL` of the Discord API"),
+		token:   flags.String("token", os.Getenv("DISCORD_TOKEN"), "Discord `TOKEN` to authenticate with, defaults to DISCORD_TOKEN"),
+		bot:     flags.Bool("bot", false, "token is a bot token"),
+	}
+}
+
+func (f *clientFlags) client() (*discord.Client, error) {
+	token := *f.token
+	if len(token) == 0 {
+		return nil, errors.New("need a Discord token via --token or DISCORD_TOKEN")
+	}
+	if *f.bot {
+		token = "Bot " + token
+	}
+	return discord.NewClient(*f.baseURL, token), nil
+}
+
+// channelArgs returns the channel IDs passed as arguments or the battle
+// royale channels by default.
+func channelArgs(flags *flag.FlagSet) []string {
+	if flags.NArg() == 0 {
+		return []string{mainChannelID, shoppingChannelID}
+	}
+	return flags.Args()
+}
+
+func runFetch(args []string) error {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	cf := addClientFlags(flags)
+	after := flags.String("after", "", "only fetch messages after this message ID instead of the last archived one")
+	before := flags.String("before", "", "only fetch messages before this message ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	return fetchChannels(context.Background(), client, channelArgs(flags), *after, *before)
+}
+
+// fetchChannels writes all messages after the given message ID, or after the
+// last archived message if empty, and before the other given message ID if
+// not empty into new exports for each channel.
+func fetchChannels(ctx context.Context, client *discord.Client, channelIDs []string, after, before string) error {
+	for _, channelID := range channelIDs {
+		lastMessageID := after
+		if len(lastMessageID) == 0 {
+			var err error
+			lastMessageID, err = lastArchivedMessageID(channelID)
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Fetching channel %s after message ID %s", channelID, lastMessageID)
+
+		backup, err := client.FetchChannel(ctx, channelID, lastMessageID, before)
+		if err != nil {
+			return fmt.Errorf("failed to fetch channel %s: %w", channelID, err)
+		}
+		if len(backup.Messages) == 0 {
+			log.Printf("No new messages in channel %s", channelID)
+			continue
+		}
+		path, err := writeBackup(backup)
+		if err != nil {
+			return err
+		}
+		log.Printf("Wrote %d messages to %s", len(backup.Messages), path)
+	}
+	return nil
+}
+
+// lastArchivedMessageID returns the newest message ID found in the local
+// exports of the channel, including archives in the exports folder, or "0" if
+// there are none yet.
+func lastArchivedMessageID(channelID string) (string, error) {
+	lastMessageID := "0"
+	exportFiles, err := findExportFiles(channelID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lastMessageID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, exportFile := range exportFiles {
+		r, err := exportFile.Open()
+		if err != nil {
+			return "", err
+		}
+		var backup struct {
+			Channel struct {
+				ID string `json:"id"`
+			} `json:"channel"`
+			Messages []struct {
+				ID string `json:"id"`
+			} `json:"messages"`
+		}
+		err = json.NewDecoder(r).Decode(&backup)
+		r.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to parse message export %s: %w", exportFile.Path, err)
+		}
+		// archives may contain exports of other channels as well
+		if backup.Channel.ID != channelID {
+			continue
+		}
+		for _, msg := range backup.Messages {
+			if discord.CompareIDs(msg.ID, lastMessageID) > 0 {
+				lastMessageID = msg.ID
+			}
+		}
+	}
+	return lastMessageID, nil
+}
+
+// writeBackup writes the backup into a new timestamped folder of the channel's
+// exports, the same way the DiscordChatExporter Makefile targets do.
+func writeBackup(backup *discord.Backup) (string, error) {
+	dir := filepath.Join(exportsPath, backup.Channel.ID, strconv.FormatInt(time.Now().Unix(), 10))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s - %s [%s].json", backup.Guild.Name, backup.Channel.Name, backup.Channel.ID)
+	path := filepath.Join(dir, strings.NewReplacer("/", "_", "\\", "_").Replace(name))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(backup); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/aliases"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/discord"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/optout"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/players"
+	"gorm.io/gorm"
+)
+
+func optOutFilePath() string {
+	if len(optOutPath) > 0 {
+		return optOutPath
+	}
+	return filepath.Join(exportsPath, "opt-out.yml")
+}
+
+// forgottenUser is a user from the opt-out list. Their names are only kept in
+// memory so mentions can still be resolved to the pseudonym.
+type forgottenUser struct {
+	pseudonym string
+	// usernames are the usernames observed, ordered by time.
+	usernames []forgottenName
+	// allNames is every name ever observed, used to scrub unresolved mentions.
+	allNames []string
+}
+
+type forgottenName struct {
+	time time.Time
+	name string
+}
+
+// usernamesUntil returns how many of the usernames were observed up to time t.
+func (u *forgottenUser) usernamesUntil(t time.Time) int {
+	i, _ := slices.BinarySearchFunc(u.usernames, t, func(n forgottenName, t time.Time) int {
+		// names observed at time t come before it
+		if n.time.After(t) {
+			return 1
+		}
+		return -1
+	})
+	return i
+}
+
+// optOutKeyArg returns the key of the opt-out list.
+func optOutKeyArg() (optout.Key, error) {
+	if len(optOutKey) == 0 {
+		return nil, errors.New("need a key via --opt-out-key or OPT_OUT_KEY for the opt-out list")
+	}
+	return optout.Key(optOutKey), nil
+}
+
+// importOptOut loads the opt-out list, accounts listed in it are replaced by
+// their pseudonym from then on.
+func (p *Processor) importOptOut() error {
+	path := optOutFilePath()
+	file, err := optout.Load(path)
+	if err != nil {
+		return err
+	}
+	p.forgotten = map[string]*forgottenUser{}
+	p.optOutHashes = nil
+	if len(file.Users) == 0 {
+		return nil
+	}
+	p.optOutKey, err = optOutKeyArg()
+	if err != nil {
+		return err
+	}
+	p.optOutHashes = file.Hashes(p.optOutKey)
+	log.Printf("Loaded %d opted out users from %s", len(file.Users), path)
+	if file.HasUserIDs() {
+		log.Printf("WARNING: %s still lists user IDs, run forget to replace them by hashes", path)
+	}
+	return nil
+}
+
+// forgottenAccount returns what is known about the account if it is on the
+// opt-out list.
+func (p *Processor) forgottenAccount(id string) (*forgottenUser, bool) {
+	if user, ok := p.forgotten[id]; ok {
+		return user, true
+	}
+	if len(p.optOutHashes) == 0 || !p.optOutHashes[p.optOutKey.Hash(id)] {
+		return nil, false
+	}
+	user := &forgottenUser{pseudonym: p.optOutKey.Pseudonym(id)}
+	p.forgotten[id] = user
+	return user, true
+}
+
+// observeForgottenName remembers the name of a forgotten user without storing
+// it anywhere.
+func (p *Processor) observeForgottenName(m discord.Message, id, name, kind string) {
+	user := p.forgotten[id]
+	if !slices.Contains(user.allNames, name) {
+		user.allNames = append(user.allNames, name)
+	}
+	if kind != database.NameKindUsername {
+		return
+	}
+	i := user.usernamesUntil(m.Timestamp)
+	if i > 0 && user.usernames[i-1].name == name {
+		return
+	}
+	user.usernames = slices.Insert(user.usernames, i, forgottenName{m.Timestamp, name})
+}
+
+// forgottenUsersWithNameAt returns the sorted IDs of the forgotten users
+// whose latest username observed up to time t is the given name.
+func (p *Processor) forgottenUsersWithNameAt(name string, t time.Time) []string {
+	ids := []string{}
+	for id, user := range p.forgotten {
+		if i := user.usernamesUntil(t); i > 0 && user.usernames[i-1].name == name {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// forgetUsers scrubs everything that still refers to forgotten users, which
+// is only the case for names that were mentioned before their user was
+// observed with them.
+func (p *Processor) forgetUsers() error {
+	for id, user := range p.forgotten {
+		if err := p.forgetUser(id, user.allNames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forgetUser moves everything the user did to their pseudonym, including
+// unresolved mentions of any of the given names, and deletes everything else
+// known about the user.
+func (p *Processor) forgetUser(id string, names []string) error {
+	pseudonym, err := p.lookupUserID(id)
+	if err != nil {
+		return err
+	}
+	if pseudonym.ID == id {
+		return errors.New("user " + id + " is not on the opt-out list")
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	return p.db.GORM().Transaction(func(db *gorm.DB) error {
+		if tx := db.Model(&database.InteractionUserMention{}).
+			Where("user_id = ?", id).
+			Updates(map[string]any{
+				"user_id":   pseudonym.ID,
+				"user_name": pseudonym.ID,
+			}); tx.Error != nil {
+			return tx.Error
+		}
+		if tx := db.Model(&database.InteractionUserMention{}).
+			Where("user_id IS NULL").
+			Where("user_ambiguous = ?", false).
+			Where("user_name IN ?", names).
+			Updates(map[string]any{
+				"user_id":               pseudonym.ID,
+				"user_name":             pseudonym.ID,
+				"resolution_method":     database.ResolutionLaterBackfill,
+				"resolution_confidence": database.ConfidenceMedium,
+			}); tx.Error != nil {
+			return tx.Error
+		}
+
+		for _, column := range []string{"host", "winner"} {
+			if tx := db.Model(&database.Game{}).
+				Where(column+"_user_id = ?", id).
+				Updates(map[string]any{
+					column + "_user_id":   pseudonym.ID,
+					column + "_user_name": pseudonym.ID,
+				}); tx.Error != nil {
+				return tx.Error
+			}
+			if tx := db.Model(&database.Game{}).
+				Where(column+"_user_id IS NULL").
+				Where(column+"_user_ambiguous = ?", false).
+				Where(column+"_user_name IN ?", names).
+				Updates(map[string]any{
+					column + "_user_id":                    pseudonym.ID,
+					column + "_user_name":                  pseudonym.ID,
+					column + "_user_resolution_method":     database.ResolutionLaterBackfill,
+					column + "_user_resolution_confidence": database.ConfidenceMedium,
+				}); tx.Error != nil {
+				return tx.Error
+			}
+		}
+
+		for _, entity := range []any{
+			&database.UserNameObservation{},
+			&database.UserRoleObservation{},
+			&database.UserAvatarObservation{},
+		} {
+			if tx := db.Where("user_id = ?", id).Delete(entity); tx.Error != nil {
+				return tx.Error
+			}
+		}
+		if tx := db.Where("id = ?", id).Delete(&database.User{}); tx.Error != nil {
+			return tx.Error
+		}
+		return deleteUnusedPlayers(db)
+	})
+}
+
+func runForget(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("forget", flag.ExitOnError)
+	note := flags.String("note", "", "note kept with the opt-out, e.g. when and how it was requested")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	userIDs := flags.Args()
+
+	key, err := optOutKeyArg()
+	if err != nil {
+		return err
+	}
+	path := optOutFilePath()
+	file, err := optout.Load(path)
+	if err != nil {
+		return err
+	}
+	// without arguments only user IDs left by older files are replaced
+	if len(userIDs) == 0 && !file.HasUserIDs() {
+		return errors.New("need at least one user ID to forget")
+	}
+	for _, id := range userIDs {
+		if !file.Add(key, id, *note) {
+			log.Printf("User %s is already on the opt-out list", id)
+		}
+	}
+	if err := file.Save(path, key); err != nil {
+		return err
+	}
+
+	// the player file must not link the pseudonym back to other accounts
+	playerFile, err := players.Load(playersFilePath())
+	if err != nil {
+		return err
+	}
+	linked := slices.DeleteFunc(slices.Clone(userIDs), func(id string) bool {
+		return playerFile.PlayerOf(id) == nil
+	})
+	if len(linked) > 0 {
+		if err := playerFile.Unlink(linked...); err != nil {
+			return err
+		}
+		if err := playerFile.Save(playersFilePath()); err != nil {
+			return err
+		}
+	}
+
+	aliasList, err := aliases.Load(aliasesFilePath())
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliasList {
+		if slices.Contains(userIDs, alias.UserID) {
+			log.Printf("WARNING: Alias %s of a forgotten user is ignored, please remove it from %s", alias, aliasesFilePath())
+		}
+	}
+
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	p := newProcessor(db)
+	if err := p.importOptOut(); err != nil {
+		return err
+	}
+	if err := p.importPlayers(); err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		var names []string
+		if tx := db.GORM().
+			Model(&database.UserNameObservation{}).
+			Distinct("name").
+			Where("user_id = ?", id).
+			Pluck("name", &names); tx.Error != nil {
+			return tx.Error
+		}
+		if err := p.forgetUser(id, names); err != nil {
+			return err
+		}
+		log.Printf("Forgot user %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build sqlite_fts5
+
+package main
+
+// fts5 tells whether SQLite was built with FTS5, which the search tables need.
+const fts5 = true
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/discord"
+)
+
+// maxLiveArchiveMessages is the amount of messages after which a new live
+// archive file is started, since the whole file is rewritten on every message.
+const maxLiveArchiveMessages = 1000
+
+// liveArchive is an export file that messages received from the gateway are
+// appended to, so importing it later gives the same results as processing the
+// messages live.
+type liveArchive struct {
+	template *discord.Backup
+
+	path   string
+	backup discord.Backup
+	source *database.ImportSource
+}
+
+func (a *liveArchive) append(p *Processor, msg discord.Message) (*database.ImportSource, error) {
+	if len(a.path) == 0 || len(a.backup.Messages) >= maxLiveArchiveMessages {
+		dir := filepath.Join(exportsPath, a.template.Channel.ID, strconv.FormatInt(time.Now().Unix(), 10))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		a.path = filepath.Join(dir, fmt.Sprintf("live [%s].json", a.template.Channel.ID))
+		a.backup = *a.template
+		a.backup.Messages = []discord.Message{}
+		a.source = nil
+	}
+
+	a.backup.Messages = append(a.backup.Messages, msg)
+	a.backup.MessageCount = len(a.backup.Messages)
+	a.backup.ExportedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(a.backup, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// write to a temporary file first so an interrupted write never leaves a
+	// broken export behind
+	if err := os.WriteFile(a.path+".tmp", data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(a.path+".tmp", a.path); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	checksum := hex.EncodeToString(hash[:])
+	if a.source == nil {
+		a.source, err = p.lookupImportSource(a.path, checksum, a.backup)
+		return a.source, err
+	}
+	a.source.Checksum = checksum
+	a.source.ExportedAt = a.backup.ExportedAt
+	if tx := p.db.GORM().Save(a.source); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return a.source, nil
+}
+
+// resume restores what the processor knew about the latest game of each
+// channel from the database, so that importing the exports again only
+// processes the messages after it.
+func (p *Processor) resume(channelIDs ...string) error {
+	if tx := p.db.GORM().Model(&database.Game{}).Select("COALESCE(MAX(id), 0)").Scan(&p.LastKnownGameID); tx.Error != nil {
+		return tx.Error
+	}
+	for _, channelID := range channelIDs {
+		var game database.Game
+		tx := p.db.GORM().
+			Where("discord_channel_id = ?", channelID).
+			Order("id DESC").
+			Limit(1).
+			Find(&game)
+		if tx.Error != nil {
+			return tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			// nothing but user observations was stored, so there is no harm
+			// in processing everything again
+			continue
+		}
+
+		c := discord.Channel{ID: channelID}
+		cs := p.channelState(c)
+		cs.LastKnownGame = game
+		cs.LastKnownIsGameRunning = game.StartTime != nil && game.EndTime == nil
+		cs.LastKnownRound = database.Round{
+			GameID: game.ID,
+			Game:   game,
+		}
+
+		resumeAfter := "0"
+		for _, id := range []string{game.SourceMessageID, game.DiscordMessageID, game.DiscordEndMessageID} {
+			if len(id) > 0 && discord.CompareIDs(id, resumeAfter) > 0 {
+				resumeAfter = id
+			}
+		}
+		var round database.Round
+		if tx := p.db.GORM().
+			Where("game_id = ?", game.ID).
+			Order("round_number DESC").
+			Limit(1).
+			Find(&round); tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected > 0 {
+			cs.LastKnownRound = round
+			p.createNewRound(c, round.RoundNumber+1)
+			if discord.CompareIDs(round.DiscordMessageID, resumeAfter) > 0 {
+				resumeAfter = round.DiscordMessageID
+			}
+		}
+		p.resumeAfter[channelID] = resumeAfter
+		log.Printf("Resuming channel %s after message %s of game %d", channelID, resumeAfter, game.ID)
+	}
+	return nil
+}
+
+// gameOfMessage returns the game the message was stored as part of, if any.
+func (p *Processor) gameOfMessage(channelID, messageID string) (*database.Game, error) {
+	var game database.Game
+	tx := p.db.GORM().
+		Where("discord_channel_id = ?", channelID).
+		Where("source_message_id = @id OR discord_message_id = @id OR discord_end_message_id = @id OR id IN (SELECT game_id FROM rounds WHERE discord_message_id = @id)",
+			map[string]any{"id": messageID}).
+		Limit(1).
+		Find(&game)
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return nil, tx.Error
+	}
+	return &game, nil
+}
+
+// listener processes messages received from the gateway.
+type listener struct {
+	p          *Processor
+	channelIDs []string
+	archives   map[string]*liveArchive
+	// lastMessageIDs maps channels to the last message that was processed.
+	lastMessageIDs map[string]string
+}
+
+func (l *listener) handle(ev discord.MessageEvent) error {
+	archive, ok := l.archives[ev.ChannelID]
+	if !ok {
+		return nil
+	}
+	if discord.CompareIDs(ev.Message.ID, l.lastMessageIDs[ev.ChannelID]) > 0 {
+		l.lastMessageIDs[ev.ChannelID] = ev.Message.ID
+		source, err := archive.append(l.p, ev.Message)
+		if err != nil {
+			return err
+		}
+		backup := *archive.template
+		backup.Messages = []discord.Message{ev.Message}
+		if err := l.p.processExport(source, backup); err != nil {
+			return fmt.Errorf("failure in live message %s: %w", ev.Message.ID, err)
+		}
+		return l.p.forgetUsers()
+	}
+
+	// created messages we already know of were fetched while catching up
+	if ev.Type != "MESSAGE_UPDATE" {
+		return nil
+	}
+	return l.update(archive, ev.ChannelID, ev.Message)
+}
+
+// update archives an edit of a message that was already processed, so that
+// importing the archive later uses the edited version, and processes the game
+// the message was stored as part of again.
+func (l *listener) update(archive *liveArchive, channelID string, msg discord.Message) error {
+	if _, err := archive.append(l.p, msg); err != nil {
+		return err
+	}
+	game, err := l.p.gameOfMessage(channelID, msg.ID)
+	if err != nil || game == nil {
+		return err
+	}
+	if len(game.SourceMessageID) == 0 {
+		log.Printf("WARNING: Message %s of game %d was edited, the change only shows after importing from scratch", msg.ID, game.ID)
+		return nil
+	}
+	log.Printf("Message %s of game %d was edited, processing the game again", msg.ID, game.ID)
+	if err := l.p.reprocessGame(game); err != nil {
+		return err
+	}
+	return l.p.forgetUsers()
+}
+
+// reprocessGame deletes a game and processes the messages it was stored from
+// again, with the latest version of each found in the exports of its channel.
+// The game keeps its ID, and the processor continues after the latest game of
+// the channel as before.
+func (p *Processor) reprocessGame(game *database.Game) error {
+	// the game lasts until the next one in the channel starts
+	var next database.Game
+	if tx := p.db.GORM().
+		Where("discord_channel_id = ?", game.DiscordChannelID).
+		Where("id > ?", game.ID).
+		Order("id").
+		Limit(1).
+		Find(&next); tx.Error != nil {
+		return tx.Error
+	}
+	inGame := func(id string) bool {
+		return discord.CompareIDs(id, game.SourceMessageID) >= 0 &&
+			(len(next.SourceMessageID) == 0 || discord.CompareIDs(id, next.SourceMessageID) < 0)
+	}
+
+	// exports from before the countdown can not contain any of the game
+	var sources []database.ImportSource
+	if tx := p.db.GORM().Where("channel_id = ?", game.DiscordChannelID).Find(&sources); tx.Error != nil {
+		return tx.Error
+	}
+	exportedAt := map[string]time.Time{}
+	for _, source := range sources {
+		if source.ExportedAt.IsZero() || !source.ExportedAt.Before(game.CountdownStartTime) {
+			exportedAt[source.Path] = source.ExportedAt
+		}
+	}
+	exportFiles, err := findExportFiles(game.DiscordChannelID)
+	if err != nil {
+		return err
+	}
+	exportFiles = slices.DeleteFunc(exportFiles, func(exportFile discord.ExportFile) bool {
+		_, ok := exportedAt[importSourcePath(exportFile.Path)]
+		return !ok
+	})
+	slices.SortStableFunc(exportFiles, func(a, b discord.ExportFile) int {
+		return exportedAt[importSourcePath(a.Path)].Compare(exportedAt[importSourcePath(b.Path)])
+	})
+
+	var backup discord.Backup
+	versions := map[string]sourcedMessage{}
+	for _, exportFile := range exportFiles {
+		b, checksum, err := readBackup(exportFile)
+		if err != nil {
+			return err
+		}
+		if b.Channel.ID != game.DiscordChannelID {
+			continue
+		}
+		source, err := p.lookupImportSource(exportFile.Path, checksum, b)
+		if err != nil {
+			return err
+		}
+		for _, m := range b.Messages {
+			if !inGame(m.ID) {
+				continue
+			}
+			if version, ok := versions[m.ID]; ok && !archived(m).newerThan(archived(version.Message)) {
+				continue
+			}
+			versions[m.ID] = sourcedMessage{m, source}
+		}
+		backup = b
+	}
+	if _, ok := versions[game.SourceMessageID]; !ok {
+		log.Printf("WARNING: Countdown message %s of game %d is not in any export, the game is left as is", game.SourceMessageID, game.ID)
+		return nil
+	}
+	messages := []sourcedMessage{}
+	for _, m := range versions {
+		messages = append(messages, m)
+	}
+	slices.SortFunc(messages, func(a, b sourcedMessage) int {
+		return discord.CompareIDs(a.ID, b.ID)
+	})
+
+	if err := p.db.DeleteGame(game.ID); err != nil {
+		return err
+	}
+	channelID := game.DiscordChannelID
+	state, lastKnownGameID, resumeAfter := p.channels[channelID], p.LastKnownGameID, p.resumeAfter[channelID]
+	delete(p.channels, channelID)
+	delete(p.resumeAfter, channelID)
+	p.LastKnownGameID = game.ID - 1
+	p.reprocessing = true
+	defer func() { p.reprocessing = false }()
+	for len(messages) > 0 {
+		n := slices.IndexFunc(messages, func(m sourcedMessage) bool {
+			return m.source != messages[0].source
+		})
+		if n < 0 {
+			n = len(messages)
+		}
+		backup.Messages = []discord.Message{}
+		for _, m := range messages[:n] {
+			backup.Messages = append(backup.Messages, m.Message)
+		}
+		if err := p.processExport(messages[0].source, backup); err != nil {
+			return fmt.Errorf("failure in processing game %d again: %w", game.ID, err)
+		}
+		messages = messages[n:]
+	}
+
+	p.LastKnownGameID = max(p.LastKnownGameID, lastKnownGameID)
+	if len(resumeAfter) > 0 {
+		p.resumeAfter[channelID] = resumeAfter
+	}
+	if next.ID != 0 && state != nil {
+		// later games are untouched, as is what is known about them
+		p.channels[channelID] = state
+	}
+	return nil
+}
+
+func runListen(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("listen", flag.ExitOnError)
+	cf := addClientFlags(flags)
+	gatewayURL := flags.String("gateway-url", discord.DefaultGatewayURL, "`URL` of the Discord gateway to receive new messages from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	channelIDs := channelArgs(flags)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// connect first and buffer events while catching up so nothing gets lost
+	// in between
+	events := make(chan discord.MessageEvent, 4096)
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- client.Listen(ctx, *gatewayURL, discord.IntentsGuildMessages, channelIDs, func(ev discord.MessageEvent) error {
+			select {
+			case events <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	// catch up with everything that happened since the last export and
+	// process whatever the database does not have yet
+	if err := fetchChannels(ctx, client, channelIDs, "", ""); err != nil {
+		return err
+	}
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	p := newProcessor(db)
+	if err := p.resume(channelIDs...); err != nil {
+		return err
+	}
+	if err := p.importExports(channelIDs...); err != nil {
+		return err
+	}
+
+	l := &listener{
+		p:              p,
+		channelIDs:     channelIDs,
+		archives:       map[string]*liveArchive{},
+		lastMessageIDs: map[string]string{},
+	}
+	for _, channelID := range channelIDs {
+		template, err := client.FetchChannelInfo(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		l.archives[channelID] = &liveArchive{template: template}
+		l.lastMessageIDs[channelID], err = lastArchivedMessageID(channelID)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Caught up, listening for new messages")
+
+	for {
+		select {
+		case err := <-listenErr:
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+
+		case ev := <-events:
+			if err := l.handle(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+// dumpScript is a file of a dump to be loaded.
+type dumpScript struct {
+	path string
+	// sha256 is the expected checksum, if known.
+	sha256 string
+}
+
+func runLoad(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	manifestPath := flags.String("manifest", "", "FILEPATH")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("need exactly one dump file or split dump directory")
+	}
+	dumpPath := flags.Arg(0)
+
+	empty, err := db.Empty()
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return fmt.Errorf("database %s is not empty, dumps can only be loaded into a fresh database", databasePath)
+	}
+
+	manifest, scripts, err := dumpScripts(dumpPath, *manifestPath)
+	if err != nil {
+		return err
+	}
+	if manifest != nil && manifest.Dialect != database.DialectSQLite {
+		return fmt.Errorf("can only load SQLite dumps, not %s", manifest.Dialect)
+	}
+
+	for _, script := range scripts {
+		b, err := os.ReadFile(script.path)
+		if err != nil {
+			return err
+		}
+		if len(script.sha256) > 0 {
+			sum := sha256.Sum256(b)
+			if hex.EncodeToString(sum[:]) != script.sha256 {
+				return fmt.Errorf("checksum of %s does not match the manifest", script.path)
+			}
+		}
+		if err := db.Load(string(b)); err != nil {
+			return fmt.Errorf("failed to load %s: %w", script.path, err)
+		}
+		log.Printf("Loaded %s", script.path)
+	}
+
+	// compare before migrating since migrations may change the data
+	if manifest != nil {
+		if err := checkRowCounts(db, manifest.Rows); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("WARNING: No manifest for %s, row counts are not checked", dumpPath)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	newVersion, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if newVersion != version {
+		log.Printf("Migrated schema from version %d to %d", version, newVersion)
+	}
+	return nil
+}
+
+// dumpScripts returns the manifest, if any, and the files of the dump at the
+// given path in the order they need to be loaded in. Split dumps are loaded
+// as listed in their manifest, a single file dump's manifest is expected next
+// to it unless given.
+func dumpScripts(dumpPath, manifestPath string) (*dumpManifest, []dumpScript, error) {
+	info, err := os.Stat(dumpPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		if len(manifestPath) == 0 {
+			manifestPath = filepath.Join(dumpPath, splitDumpManifestFile)
+		}
+		manifest, err := loadDumpManifest(manifestPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(manifest.Files) == 0 {
+			return nil, nil, fmt.Errorf("manifest %s lists no files", manifestPath)
+		}
+		scripts := []dumpScript{}
+		for _, file := range manifest.Files {
+			scripts = append(scripts, dumpScript{
+				path:   filepath.Join(dumpPath, file.Name),
+				sha256: file.SHA256,
+			})
+		}
+		return manifest, scripts, nil
+	}
+
+	script := dumpScript{path: dumpPath}
+	if len(manifestPath) == 0 {
+		manifestPath = strings.TrimSuffix(dumpPath, filepath.Ext(dumpPath)) + ".json"
+		if _, err := os.Stat(manifestPath); errors.Is(err, os.ErrNotExist) {
+			return nil, []dumpScript{script}, nil
+		}
+	}
+	manifest, err := loadDumpManifest(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	script.sha256 = manifest.SHA256
+	return manifest, []dumpScript{script}, nil
+}
+
+// checkRowCounts compares the amount of rows in each table with the expected
+// amounts.
+func checkRowCounts(db *database.Database, expected map[string]int64) error {
+	counts, err := db.RowCounts()
+	if err != nil {
+		return err
+	}
+	tables := []string{}
+	for table := range expected {
+		tables = append(tables, table)
+	}
+	slices.Sort(tables)
+	errs := []error{}
+	for _, table := range tables {
+		count, ok := counts[table]
+		if !ok {
+			errs = append(errs, fmt.Errorf("table %s is missing", table))
+		} else if count != expected[table] {
+			errs = append(errs, fmt.Errorf("table %s has %d rows instead of %d", table, count, expected[table]))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("dump was not loaded completely: %w", err)
+	}
+	log.Printf("Row counts of %d tables match the manifest", len(tables))
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -20,11 +22,15 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
 	"github.com/icedream/hololive-bettel-royale-data-processing/internal/discord"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/markdown"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/optout"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/template"
 	_ "github.com/mattn/go-sqlite3"
 	"gorm.io/gorm"
 )
 
 const (
+	guildID           = `558322816416743459`
 	mainChannelID     = `1224009923457847428`
 	shoppingChannelID = `1224017701744410695`
 	botAuthorID       = `693167035068317736`
@@ -33,17 +39,58 @@ const (
 var (
 	exportsPath  = "discord-exports"
 	databasePath = "main.db"
+	aliasesPath  = "" // defaults to aliases.yml in exportsPath
+	playersPath  = "" // defaults to players.yml in exportsPath
+	optOutPath   = "" // defaults to opt-out.yml in exportsPath
+	optOutKey    = os.Getenv("OPT_OUT_KEY")
 )
 
 func init() {
 	flag.StringVar(&exportsPath, "exports-path", exportsPath, "DIRPATH")
 	flag.StringVar(&databasePath, "database-path", databasePath, "FILEPATH")
+	flag.StringVar(&aliasesPath, "aliases-path", aliasesPath, "FILEPATH")
+	flag.StringVar(&playersPath, "players-path", playersPath, "FILEPATH")
+	flag.StringVar(&optOutPath, "opt-out-path", optOutPath, "FILEPATH")
+	flag.StringVar(&optOutKey, "opt-out-key", optOutKey, "secret `KEY` the opt-out list is hashed with, defaults to OPT_OUT_KEY")
 	flag.Parse()
 }
 
 type backupFile struct {
 	firstMessageTime time.Time
-	file             *os.File
+	exportFile       discord.ExportFile
+	messages         []archivedMessage
+}
+
+// archivedMessage is a version of a message as found in an export. The same
+// message may be exported several times, e.g. by overlapping exports or when
+// the listener archived an edit of it.
+type archivedMessage struct {
+	ID              string     `json:"id"`
+	Timestamp       time.Time  `json:"timestamp"`
+	TimestampEdited *time.Time `json:"timestampEdited"`
+}
+
+// newerThan returns whether the message version replaces the other one that
+// was found earlier.
+func (m archivedMessage) newerThan(other archivedMessage) bool {
+	return other.TimestampEdited == nil ||
+		(m.TimestampEdited != nil && !m.TimestampEdited.Before(*other.TimestampEdited))
+}
+
+// archived returns the version of a message.
+func archived(m discord.Message) archivedMessage {
+	return archivedMessage{
+		ID:              m.ID,
+		Timestamp:       m.Timestamp,
+		TimestampEdited: m.TimestampEdited,
+	}
+}
+
+// sourcedMessage is a message along with the import source of the export its
+// version was taken from.
+type sourcedMessage struct {
+	discord.Message
+	source *database.ImportSource
 }
 
 func main() {
@@ -51,6 +98,9 @@ func main() {
 	if len(subcommand) == 0 {
 		log.Fatal("Need a subcommand to execute")
 	}
+	if !fts5 {
+		log.Fatal("This tool was built without sqlite_fts5, which the database needs, build it with -tags sqlite_fts5 or make")
+	}
 
 	db, err := database.OpenSQLite(databasePath)
 	if err != nil {
@@ -59,7 +109,32 @@ func main() {
 
 	switch subcommand {
 	case "dump":
-		if err := runDump(db); err != nil {
+		if err := runDump(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "export":
+		if err := runExport(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "fetch":
+		if err := runFetch(flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "link-accounts":
+		if err := runLinkAccounts(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "listen":
+		if err := runListen(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "forget":
+		if err := runForget(db, flag.Args()[1:]); err != nil {
 			panic(err)
 		}
 
@@ -68,11 +143,43 @@ func main() {
 			panic(err)
 		}
 
-	case "reset":
-		if err := db.AutoMigrate(); err != nil {
+	case "load":
+		if err := runLoad(db, flag.Args()[1:]); err != nil {
 			panic(err)
 		}
-		if err := db.Export(os.Stdout); err != nil {
+
+	case "migrate":
+		if err := runMigrate(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "names":
+		if err := runNames(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "resolution-report":
+		if err := runResolutionReport(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "search":
+		if err := runSearch(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "unlink-accounts":
+		if err := runUnlinkAccounts(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "verify":
+		if err := runVerify(db, flag.Args()[1:]); err != nil {
+			panic(err)
+		}
+
+	case "reset":
+		if err := runReset(db, flag.Args()[1:]); err != nil {
 			panic(err)
 		}
 
@@ -90,11 +197,98 @@ type channelState struct {
 type Processor struct {
 	db *database.Database
 
+	// source is the import source of the export currently being processed.
+	source *database.ImportSource
+
+	// playerIDs maps accounts listed in the player file to their player.
+	playerIDs map[string]int
+	// optOutKey and optOutHashes identify accounts on the opt-out list.
+	optOutKey    optout.Key
+	optOutHashes map[string]bool
+	// forgotten maps accounts on the opt-out list seen so far to what is
+	// known about them.
+	forgotten map[string]*forgottenUser
+
 	channels        map[string]*channelState
 	LastKnownGameID int
+
+	// resumeAfter maps channels to the last message that was already
+	// processed into the database, see resume.
+	resumeAfter map[string]string
+	// reprocessing is set while messages are processed again whose users
+	// were already observed, see reprocessGame.
+	reprocessing bool
 }
 
-func runDump(db *database.Database) error {
+func runDump(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	pseudonymize := flags.Bool("pseudonymize", false, "replace user IDs, names and message IDs with pseudonyms")
+	pseudonymizeKey := flags.String("pseudonymize-key", os.Getenv("PSEUDONYMIZE_KEY"), "secret `KEY` the pseudonyms are derived from, defaults to PSEUDONYMIZE_KEY")
+	dialect := flags.String("dialect", database.DialectSQLite, "sqlite, postgres or mysql")
+	deterministic := flags.Bool("deterministic", false, "order everything so the dump only changes where the data does")
+	splitDir := flags.String("split-dir", "", "DIRPATH")
+	manifestPath := flags.String("manifest", "", "FILEPATH")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*splitDir) > 0 {
+		if len(*manifestPath) > 0 {
+			return errors.New("split dumps always write their manifest to the split directory")
+		}
+		*deterministic = true
+	}
+	if *deterministic && *dialect != database.DialectSQLite {
+		return errors.New("deterministic dumps are only supported for SQLite")
+	}
+	var compatibility string
+	switch *dialect {
+	case database.DialectSQLite:
+		compatibility = "SQLite"
+	case database.DialectPostgres:
+		compatibility = "PostgreSQL"
+	case database.DialectMySQL:
+		compatibility = "MySQL and MariaDB"
+	default:
+		return fmt.Errorf("unsupported dialect: %s", *dialect)
+	}
+
+	// the schema version tells users of the dump whether their queries need
+	// to change, so it has to be accurate
+	schemaVersion, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latestSchemaVersion, err := database.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if schemaVersion != latestSchemaVersion {
+		return fmt.Errorf("database schema is at version %d instead of %d, run migrate up first", schemaVersion, latestSchemaVersion)
+	}
+	if *pseudonymize {
+		if len(*pseudonymizeKey) == 0 {
+			return errors.New("need a key via --pseudonymize-key or PSEUDONYMIZE_KEY to pseudonymize")
+		}
+		// work on a copy so the original database is left untouched
+		dir, err := os.MkdirTemp("", "process-discord-exports-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "pseudonymized.db")
+		if err := db.CopyTo(path); err != nil {
+			return err
+		}
+		db, err = database.OpenSQLite(path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err := db.Pseudonymize([]byte(*pseudonymizeKey)); err != nil {
+			return err
+		}
+	}
+
 	// figure out last effective update time
 	timestamps := []time.Time{}
 	var lastGame database.Game
@@ -124,121 +318,389 @@ func runDump(db *database.Database) error {
 		}
 	}
 
-	if _, err := os.Stdout.WriteString(fmt.Sprintf(`--
+	pseudonymizedNote := ""
+	if *pseudonymize {
+		pseudonymizedNote = `
+-- User IDs, names and Discord message IDs in this dump are pseudonymized.
+--`
+	}
+
+	header := fmt.Sprintf(`--
 -- Hololive Battle Royale statistics dump
 --
--- This dump is entirely compatible with SQLite.
+-- This dump is entirely compatible with %s.
 --
--- Latest game time considered in this dump: %s
+-- Schema version: %d
 --
+-- Latest game time considered in this dump: %s
+--%s
 -- DO NOT EDIT. This was autogenerated by a tool.
 --
 
-`, latestTimestamp)); err != nil {
-		return err
+`, compatibility, schemaVersion, latestTimestamp, pseudonymizedNote)
+
+	var manifest *dumpManifest
+	if len(*splitDir) > 0 || len(*manifestPath) > 0 {
+		manifest, err = newDumpManifest(db, schemaVersion, *dialect, *pseudonymize, latestTimestamp)
+		if err != nil {
+			return err
+		}
+	}
+	if len(*splitDir) > 0 {
+		return writeSplitDump(db, *splitDir, header, manifest)
 	}
 
-	if err := db.Export(os.Stdout); err != nil {
+	out := newHashingWriter(os.Stdout)
+	if _, err := io.WriteString(out, header); err != nil {
+		return err
+	}
+	if *deterministic {
+		_, err = db.ExportSorted(func(string) (io.WriteCloser, error) {
+			return nopWriteCloser{out}, nil
+		})
+	} else if *dialect != database.DialectSQLite {
+		err = db.ExportDialect(out, *dialect)
+	} else {
+		err = db.Export(out)
+	}
+	if err != nil {
 		return err
 	}
 
+	if manifest != nil {
+		manifest.SHA256 = out.sum()
+		return manifest.save(*manifestPath)
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
 	return nil
 }
 
+// hashedFile is a dump part that is being written to a file.
+type hashedFile struct {
+	*hashingWriter
+	f *os.File
+}
+
+func (f hashedFile) Close() error {
+	return f.f.Close()
+}
+
+// writeSplitDump writes a sorted dump to one file per table along with a
+// manifest, so changes to a table only show up in its own file.
+func writeSplitDump(db *database.Database, dir, header string, manifest *dumpManifest) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	files := map[string]hashedFile{}
+	parts, err := db.ExportSorted(func(part string) (io.WriteCloser, error) {
+		f, err := os.Create(filepath.Join(dir, part+".sql"))
+		if err != nil {
+			return nil, err
+		}
+		file := hashedFile{newHashingWriter(f), f}
+		if part == database.SchemaDumpPart {
+			if _, err := io.WriteString(file, header); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		files[part] = file
+		return file, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	manifest.Files = []dumpFile{}
+	for _, part := range parts {
+		manifest.Files = append(manifest.Files, dumpFile{
+			Name:   part + ".sql",
+			SHA256: files[part].sum(),
+		})
+	}
+	return manifest.save(filepath.Join(dir, splitDumpManifestFile))
+}
+
+func runReset(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("reset", flag.ExitOnError)
+	keepUsers := flags.Bool("keep-users", false, "keep import_sources, players, users, user_name_observations, user_role_observations and user_avatar_observations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	return db.Reset(*keepUsers)
+}
+
 func runImport(db *database.Database) error {
-	if err := db.AutoMigrate(); err != nil {
+	if err := db.Migrate(); err != nil {
 		return err
 	}
 
 	p := newProcessor(db)
-	processDir := func(channelIDs ...string) error {
-		backupFiles := []backupFile{}
 
-		walkFunc := func(path string, info fs.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() || !strings.EqualFold(filepath.Ext(info.Name()), ".json") {
-				return nil
-			}
-			r, err := os.OpenFile(path, os.O_RDONLY, 0o400)
-			if err != nil {
-				return err
-			}
-			// r will be closed in second loop
+	// if err := p.importExports(shoppingChannelID); err != nil {
+	// 	return err
+	// }
+	// if err := p.importExports(mainChannelID); err != nil {
+	// 	return err
+	// }
 
-			// only extract first message timestamp for sorting
-			var backup struct {
-				Messages []struct {
-					Timestamp time.Time `json:"timestamp"`
-				} `json:"messages"`
-			}
-			if err := json.NewDecoder(r).Decode(&backup); err != nil {
-				return err
-			}
-			if _, err := r.Seek(0, io.SeekStart); err != nil {
-				return err
-			}
+	if err := p.importExports(shoppingChannelID, mainChannelID); err != nil {
+		return err
+	}
 
-			firstMessage := backup.Messages[0]
-			backupFiles = append(backupFiles, backupFile{
-				file:             r,
-				firstMessageTime: firstMessage.Timestamp,
-			})
+	return nil
+}
+
+// importExports processes all exports of the given channels in chronological
+// order.
+func (p *Processor) importExports(channelIDs ...string) error {
+	if err := p.importOptOut(); err != nil {
+		return err
+	}
+	if err := p.importPlayers(); err != nil {
+		return err
+	}
+	if err := p.importAliases(); err != nil {
+		return err
+	}
+
+	exportFiles, err := findExportFiles(channelIDs...)
+	if err != nil {
+		return err
+	}
 
+	backupFiles := []backupFile{}
+	exportCount := map[string]int{}
+
+	addExportFile := func(exportFile discord.ExportFile) error {
+		r, err := exportFile.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		// only extract channel and message IDs and timestamps for sorting
+		var backup struct {
+			Channel struct {
+				ID string `json:"id"`
+			} `json:"channel"`
+			Messages []archivedMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r).Decode(&backup); err != nil {
+			return fmt.Errorf("failed to parse message export %s: %w", exportFile.Path, err)
+		}
+		if !slices.Contains(channelIDs, backup.Channel.ID) || len(backup.Messages) == 0 {
 			return nil
 		}
 
-		// extract timestamps from each discord export
-		for _, channelID := range channelIDs {
-			if err := filepath.Walk(exportsPath+"/"+channelID, walkFunc); err != nil {
-				return err
+		for _, m := range backup.Messages {
+			exportCount[m.ID]++
+		}
+		backupFiles = append(backupFiles, backupFile{
+			exportFile: exportFile,
+			messages:   backup.Messages,
+		})
+
+		return nil
+	}
+
+	// extract timestamps from each discord export
+	for _, exportFile := range exportFiles {
+		if err := addExportFile(exportFile); err != nil {
+			return err
+		}
+	}
+
+	// messages exported again later, such as archived edits, say nothing
+	// about where an export starts
+	for i, backupFile := range backupFiles {
+		backupFiles[i].firstMessageTime = backupFile.messages[0].Timestamp
+		for _, m := range backupFile.messages {
+			if exportCount[m.ID] == 1 {
+				backupFiles[i].firstMessageTime = m.Timestamp
+				break
 			}
 		}
+	}
 
-		// sort backups by which timestamps they start from so they are linear history
-		slices.SortFunc(backupFiles, func(a, b backupFile) int {
-			if a.firstMessageTime == b.firstMessageTime {
-				return strings.Compare(a.file.Name(), b.file.Name())
+	// sort backups by which timestamps they start from so they are linear history
+	slices.SortFunc(backupFiles, func(a, b backupFile) int {
+		if a.firstMessageTime == b.firstMessageTime {
+			return strings.Compare(a.exportFile.Path, b.exportFile.Path)
+		}
+		if a.firstMessageTime.After(b.firstMessageTime) {
+			return 1
+		}
+		return -1
+	})
+
+	// messages exported several times are processed where they were first
+	// exported, but with their latest version
+	type messageVersion struct {
+		archivedMessage
+		file, index int
+	}
+	latest := map[string]messageVersion{}
+	for i, backupFile := range backupFiles {
+		for j, m := range backupFile.messages {
+			if exportCount[m.ID] < 2 {
+				continue
 			}
-			if a.firstMessageTime.After(b.firstMessageTime) {
-				return 1
+			if version, ok := latest[m.ID]; ok && !m.newerThan(version.archivedMessage) {
+				continue
 			}
-			return -1
-		})
+			latest[m.ID] = messageVersion{m, i, j}
+		}
+	}
+	versions := map[string]sourcedMessage{}
+	if len(latest) > 0 {
+		log.Printf("Found %d messages exported more than once, using their latest version", len(latest))
+		for i, backupFile := range backupFiles {
+			var backup *discord.Backup
+			var source *database.ImportSource
+			for id, version := range latest {
+				if version.file != i {
+					continue
+				}
+				if backup == nil {
+					b, checksum, err := readBackup(backupFile.exportFile)
+					if err != nil {
+						return err
+					}
+					backup = &b
+					source, err = p.lookupImportSource(backupFile.exportFile.Path, checksum, b)
+					if err != nil {
+						return err
+					}
+				}
+				versions[id] = sourcedMessage{backup.Messages[version.index], source}
+			}
+		}
+	}
 
-		// actually process the backups
-		for _, backupFile := range backupFiles {
-			var backup discord.Backup
-			if err := json.NewDecoder(backupFile.file).Decode(&backup); err != nil {
-				return fmt.Errorf("failed to parse message export %s: %w", backupFile.file.Name(), err)
+	// actually process the backups
+	processed := map[string]bool{}
+	for _, backupFile := range backupFiles {
+		backup, checksum, err := readBackup(backupFile.exportFile)
+		if err != nil {
+			return err
+		}
+		source, err := p.lookupImportSource(backupFile.exportFile.Path, checksum, backup)
+		if err != nil {
+			return err
+		}
+		// later versions are processed as coming from their own export
+		messages := []sourcedMessage{}
+		for _, m := range backup.Messages {
+			if processed[m.ID] {
+				continue
 			}
-			backupFile.file.Close()
-			if err := p.processExport(backup); err != nil {
-				return fmt.Errorf("failure in message export %s: %w", backupFile.file.Name(), err)
+			processed[m.ID] = true
+			message := sourcedMessage{m, source}
+			if version, ok := versions[m.ID]; ok {
+				message = version
 			}
+			messages = append(messages, message)
+		}
+		for len(messages) > 0 {
+			n := slices.IndexFunc(messages, func(m sourcedMessage) bool {
+				return m.source != messages[0].source
+			})
+			if n < 0 {
+				n = len(messages)
+			}
+			backup.Messages = []discord.Message{}
+			for _, m := range messages[:n] {
+				backup.Messages = append(backup.Messages, m.Message)
+			}
+			if err := p.processExport(messages[0].source, backup); err != nil {
+				return fmt.Errorf("failure in message export %s: %w", backupFile.exportFile.Path, err)
+			}
+			messages = messages[n:]
 		}
-		return nil
 	}
+	return p.forgetUsers()
+}
 
-	// if err := processDir(shoppingChannelID); err != nil {
-	// 	return err
-	// }
-	// if err := processDir(mainChannelID); err != nil {
-	// 	return err
-	// }
+// findExportFiles returns the export files that may contain exports of the
+// given channels.
+func findExportFiles(channelIDs ...string) ([]discord.ExportFile, error) {
+	// archives directly in the exports folder may contain exports of
+	// several channels at once
+	exportFiles := []discord.ExportFile{}
+	entries, err := os.ReadDir(exportsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !discord.IsExportFileName(entry.Name()) {
+			continue
+		}
+		files, err := discord.FindExportFiles(filepath.Join(exportsPath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		exportFiles = append(exportFiles, files...)
+	}
+	for _, channelID := range channelIDs {
+		files, err := discord.FindExportFiles(exportsPath + "/" + channelID)
+		if errors.Is(err, fs.ErrNotExist) {
+			// channel may only be exported in one of the archives
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		exportFiles = append(exportFiles, files...)
+	}
+	return exportFiles, nil
+}
 
-	if err := processDir(shoppingChannelID, mainChannelID); err != nil {
-		return err
+// readBackup parses an export file and returns it along with its checksum.
+func readBackup(exportFile discord.ExportFile) (discord.Backup, string, error) {
+	var backup discord.Backup
+	f, err := exportFile.Open()
+	if err != nil {
+		return backup, "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	r := io.TeeReader(f, hash)
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return backup, "", fmt.Errorf("failed to parse message export %s: %w", exportFile.Path, err)
 	}
+	// hash whatever the decoder did not need to read
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return backup, "", err
+	}
+	return backup, hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-	return nil
+// importSourcePath returns the path an export file is recorded with as an
+// import source, relative to the exports folder if possible.
+func importSourcePath(path string) string {
+	if relPath, err := filepath.Rel(exportsPath, path); err == nil {
+		path = relPath
+	}
+	return filepath.ToSlash(path)
 }
 
 func newProcessor(db *database.Database) *Processor {
 	return &Processor{
-		db:       db,
-		channels: map[string]*channelState{},
+		db:          db,
+		channels:    map[string]*channelState{},
+		resumeAfter: map[string]string{},
 	}
 }
 
@@ -287,27 +749,150 @@ func (p *Processor) storeUser(u *database.User) error {
 	return nil
 }
 
-func (p *Processor) lookupUserName(m discord.Message, name string) (*database.User, error) {
+// userResolution is the result of looking up which user a name referred to.
+type userResolution struct {
+	User *database.User
+	// Ambiguous is set if several users had the name at the time, User is
+	// left nil in that case.
+	Ambiguous  bool
+	Method     string
+	Confidence string
+	// Name replaces the looked up name if set, which is the case for
+	// forgotten users.
+	Name string
+}
+
+// usersWithNameAt returns the observations of the given name that were the
+// latest observation of their user and name kind at time t, as well as all
+// users who ever had the name. Only observations of the given kinds are
+// considered, they must be sorted by user ID, kind and time.
+func usersWithNameAt(observations []database.UserNameObservation, name string, t time.Time, kinds ...string) ([]*database.UserNameObservation, []*database.User) {
+	candidates := []*database.UserNameObservation{}
+	everHadName := []*database.User{}
+	for i, observation := range observations {
+		if !slices.Contains(kinds, observation.Kind) {
+			continue
+		}
+		isLastOfUser := i+1 == len(observations) ||
+			observations[i+1].UserID != observation.UserID ||
+			observations[i+1].Kind != observation.Kind
+		if observation.Name == name && (len(everHadName) == 0 || everHadName[len(everHadName)-1].ID != observation.UserID) {
+			everHadName = append(everHadName, &observations[i].User)
+		}
+		if observation.Time.After(t) {
+			continue
+		}
+		// only the latest observation up to the message time counts
+		if !isLastOfUser && !observations[i+1].Time.After(t) {
+			continue
+		}
+		if observation.Name != name {
+			continue
+		}
+		if observation.ValidUntil != nil && !t.Before(*observation.ValidUntil) {
+			continue
+		}
+		candidates = append(candidates, &observations[i])
+	}
+	return candidates, everHadName
+}
+
+// lookupUserName finds the user who had the given name at the time of the
+// message, judging by which name each user was last observed with before
+// that time. Usernames are preferred, display names and nicknames are only
+// used as a fallback since they are not unique.
+func (p *Processor) lookupUserName(m discord.Message, name string) (userResolution, error) {
 	if len(name) == 0 {
-		return nil, errors.New("empty username")
+		return userResolution{}, errors.New("empty username")
 	}
-	u := database.UserNameObservation{}
-	// next-best guess principle, also partially trust that people didn't take
-	// each other's nicknames (which thanks to april fools is an even more than
-	// usual unreliable unassumption... oh well, we'll see how it holds)
-	tx := p.db.GORM().
+	// the discriminator of legacy accounts is not part of the observed name
+	if match := rxLegacyUserTag.FindStringSubmatch(name); match != nil {
+		name = match[1]
+	}
+
+	// names of forgotten users are only known in memory
+	if ids := p.forgottenUsersWithNameAt(name, m.Timestamp); len(ids) > 0 {
+		confidence := database.ConfidenceHigh
+		if len(ids) > 1 {
+			// still better than leaving the name of a forgotten user behind
+			log.Printf("WARNING: User name %s was held by %d forgotten users at message ID %s, using the first", name, len(ids), m.ID)
+			confidence = database.ConfidenceLow
+		}
+		user, err := p.lookupUserID(ids[0])
+		if err != nil {
+			return userResolution{}, err
+		}
+		return userResolution{
+			User:       &user,
+			Method:     database.ResolutionExactAtTime,
+			Confidence: confidence,
+			Name:       user.ID,
+		}, nil
+	}
+
+	// all observations of every user who ever had that name
+	var observations []database.UserNameObservation
+	if tx := p.db.GORM().
 		Preload("User").
-		Where("name = ?", name).
-		Last(&u)
-	err := tx.Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		log.Printf("WARNING: Could not find ID of user name %s for message ID %s, leaving null for now", name, m.ID)
-		return nil, nil
+		Where("user_id IN (?)", p.db.GORM().
+			Model(&database.UserNameObservation{}).
+			Distinct("user_id").
+			Where("name = ?", name)).
+		Order("user_id").
+		Order("kind").
+		Order("time").
+		Order("id").
+		Find(&observations); tx.Error != nil {
+		return userResolution{}, tx.Error
+	}
+
+	usernameCandidates, usernameEverHadName := usersWithNameAt(observations, name, m.Timestamp,
+		database.NameKindUsername)
+	displayNameCandidates, displayNameEverHadName := usersWithNameAt(observations, name, m.Timestamp,
+		database.NameKindGlobalName, database.NameKindGuildNickname, database.NameKindDisplayName)
+
+	for _, candidates := range [][]*database.UserNameObservation{usernameCandidates, displayNameCandidates} {
+		confidence := database.ConfidenceHigh
+		if len(candidates) > 0 && candidates[0].Kind != database.NameKindUsername {
+			confidence = database.ConfidenceMedium
+		}
+		switch {
+		case len(candidates) == 1 && candidates[0].Source == database.ObservationSourceAlias:
+			return userResolution{
+				User:       &candidates[0].User,
+				Method:     database.ResolutionManualAlias,
+				Confidence: confidence,
+			}, nil
+		case len(candidates) == 1:
+			return userResolution{
+				User:       &candidates[0].User,
+				Method:     database.ResolutionExactAtTime,
+				Confidence: confidence,
+			}, nil
+		case len(candidates) > 1:
+			log.Printf("WARNING: User name %s was held by %d users at message ID %s, leaving null", name, len(candidates), m.ID)
+			return userResolution{Ambiguous: true, Confidence: database.ConfidenceNone}, nil
+		}
 	}
-	if err != nil {
-		return nil, err
+
+	// nobody was observed with the name at that time yet, which happens when
+	// someone got renamed before an export picked up on it. As long as only a
+	// single user ever had that name that's still a safe guess.
+	for _, everHadName := range [][]*database.User{usernameEverHadName, displayNameEverHadName} {
+		switch {
+		case len(everHadName) == 1:
+			return userResolution{
+				User:       everHadName[0],
+				Method:     database.ResolutionOnlyUserWithName,
+				Confidence: database.ConfidenceLow,
+			}, nil
+		case len(everHadName) > 1:
+			log.Printf("WARNING: User name %s was held by %d users but none of them at message ID %s, leaving null", name, len(everHadName), m.ID)
+			return userResolution{Ambiguous: true, Confidence: database.ConfidenceNone}, nil
+		}
 	}
-	return &u.User, err
+	log.Printf("WARNING: Could not find ID of user name %s for message ID %s, leaving null for now", name, m.ID)
+	return userResolution{Confidence: database.ConfidenceNone}, nil
 }
 
 func (p *Processor) lookupUserID(id string) (database.User, error) {
@@ -315,6 +900,9 @@ func (p *Processor) lookupUserID(id string) (database.User, error) {
 	if len(id) == 0 {
 		return u, errors.New("empty username")
 	}
+	if forgotten, ok := p.forgottenAccount(id); ok {
+		id = forgotten.pseudonym
+	}
 	tx := p.db.GORM().
 		Where("id = ?", id).
 		First(&u)
@@ -326,8 +914,13 @@ func (p *Processor) lookupUserID(id string) (database.User, error) {
 		return u, err
 	}
 	if tx.RowsAffected == 0 {
+		playerID, err := p.playerID(id)
+		if err != nil {
+			return u, err
+		}
 		u.ID = id
-		err = p.storeUser(&u)
+		u.PlayerID = &playerID
+		return u, p.storeUser(&u)
 	}
 	return u, err
 }
@@ -388,17 +981,228 @@ func (p *Processor) lookupInteractionMessage(text, event string) (database.Inter
 	if tx.RowsAffected == 0 {
 		i.Text = text
 		i.Event = event
-		err = p.storeInteractionMessage(&i)
+		if err := p.storeInteractionMessage(&i); err != nil {
+			return i, err
+		}
+		if slots := template.Slots(i); len(slots) > 0 {
+			err = p.db.GORM().Create(&slots).Error
+		}
 	}
 	return i, err
 }
 
+func (p *Processor) lookupImportSource(path, checksum string, backup discord.Backup) (*database.ImportSource, error) {
+	path = importSourcePath(path)
+	s := database.ImportSource{}
+	tx := p.db.GORM().
+		Where("path = ?", path).
+		Where("checksum = ?", checksum).
+		First(&s)
+	err := tx.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tx.RowsAffected == 0 {
+		s = database.ImportSource{
+			Path:       path,
+			Checksum:   checksum,
+			ExportedAt: backup.ExportedAt,
+			ChannelID:  backup.Channel.ID,
+		}
+		if tx := p.db.GORM().Create(&s); tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+	return &s, nil
+}
+
+// sourceImportID returns the ID of the import source currently being
+// processed, if any.
+func (p *Processor) sourceImportID() *int {
+	if p.source == nil {
+		return nil
+	}
+	return &p.source.ID
+}
+
 func (p *Processor) wrapError(msg discord.Message, err error) error {
 	err = fmt.Errorf("failure at message ID %s: %w", msg.ID, err)
 	return err
 }
 
-func (p *Processor) observeUserName(m discord.Message, id, name string) error {
+// messageUsers returns every user a message tells something about: the user
+// of an interaction, mentioned and reacting users and the author unless it is
+// the bot.
+func messageUsers(msg discord.Message) []discord.User {
+	users := []discord.User{}
+	if msg.Interaction != nil {
+		users = append(users, msg.Interaction.User)
+	}
+	users = append(users, msg.Mentions...)
+	for _, reaction := range msg.Reactions {
+		users = append(users, reaction.Users...)
+	}
+	if msg.Author.ID != botAuthorID {
+		users = append(users, discord.User(msg.Author))
+	}
+	return users
+}
+
+// observeUser records the username as well as the display name of a user as
+// seen in a message.
+func (p *Processor) observeUser(m discord.Message, user discord.User) error {
+	if err := p.observeUserName(m, user.ID, user.Name, database.NameKindUsername); err != nil {
+		return err
+	}
+	switch {
+	case len(user.GlobalName) > 0:
+		// fetched via the API, so we can tell both names apart
+		if err := p.observeUserName(m, user.ID, user.GlobalName, database.NameKindGlobalName); err != nil {
+			return err
+		}
+		if len(user.Nickname) > 0 && user.Nickname != user.GlobalName {
+			if err := p.observeUserName(m, user.ID, user.Nickname, database.NameKindGuildNickname); err != nil {
+				return err
+			}
+		}
+	case len(user.Nickname) > 0 && user.Nickname != user.Name:
+		if err := p.observeUserName(m, user.ID, user.Nickname, database.NameKindDisplayName); err != nil {
+			return err
+		}
+	}
+	if err := p.observeUserRoles(m, user); err != nil {
+		return err
+	}
+	return p.observeUserAvatar(m, user)
+}
+
+// observeUserRoles records the roles of the user if they changed since the
+// last observation. Exports leave out the roles in some places, which is not
+// the same as having no roles.
+func (p *Processor) observeUserRoles(m discord.Message, user discord.User) error {
+	if _, ok := p.forgottenAccount(user.ID); ok || user.Roles == nil {
+		return nil
+	}
+	u, err := p.lookupUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	observations := []database.UserRoleObservation{}
+	for _, role := range user.Roles {
+		observation := database.UserRoleObservation{
+			User:         u,
+			UserID:       u.ID,
+			Time:         m.Timestamp,
+			RoleID:       &role.ID,
+			RoleName:     role.Name,
+			RolePosition: role.Position,
+
+			SourceImportID:  p.sourceImportID(),
+			SourceMessageID: m.ID,
+		}
+		if color, ok := role.Color.(string); ok {
+			observation.RoleColor = &color
+		}
+		observations = append(observations, observation)
+	}
+	if len(observations) == 0 {
+		observations = append(observations, database.UserRoleObservation{
+			User:   u,
+			UserID: u.ID,
+			Time:   m.Timestamp,
+
+			SourceImportID:  p.sourceImportID(),
+			SourceMessageID: m.ID,
+		})
+	}
+
+	var lastChange []database.UserRoleObservation
+	var last database.UserRoleObservation
+	if tx := p.db.GORM().
+		Where("user_id = ?", user.ID).
+		Last(&last); tx.Error == nil {
+		if tx := p.db.GORM().
+			Where("user_id = ?", user.ID).
+			Where("time = ?", last.Time).
+			Where("source_message_id = ?", last.SourceMessageID).
+			Find(&lastChange); tx.Error != nil {
+			return tx.Error
+		}
+	} else if !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return tx.Error
+	}
+	roleKey := func(o database.UserRoleObservation) string {
+		if o.RoleID == nil {
+			return ""
+		}
+		return *o.RoleID + "/" + o.RoleName
+	}
+	lastRoles := []string{}
+	for _, observation := range lastChange {
+		lastRoles = append(lastRoles, roleKey(observation))
+	}
+	roles := []string{}
+	for _, observation := range observations {
+		roles = append(roles, roleKey(observation))
+	}
+	slices.Sort(lastRoles)
+	slices.Sort(roles)
+	if slices.Equal(lastRoles, roles) {
+		return nil // these roles are already observed to be the latest ones
+	}
+
+	if tx := p.db.GORM().Create(&observations); tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+// observeUserAvatar records the avatar of the user if it changed since the
+// last observation.
+func (p *Processor) observeUserAvatar(m discord.Message, user discord.User) error {
+	if _, ok := p.forgottenAccount(user.ID); ok || len(user.AvatarURL) == 0 {
+		return nil
+	}
+
+	var lastChange database.UserAvatarObservation
+	if tx := p.db.GORM().
+		Where("user_id = ?", user.ID).
+		Last(&lastChange); tx.Error == nil {
+		if lastChange.AvatarURL == user.AvatarURL {
+			return nil // this avatar is already observed to be the latest one
+		}
+	} else if !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return tx.Error
+	}
+
+	u, err := p.lookupUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	lastChange = database.UserAvatarObservation{
+		User:      u,
+		UserID:    u.ID,
+		Time:      m.Timestamp,
+		AvatarURL: user.AvatarURL,
+
+		SourceImportID:  p.sourceImportID(),
+		SourceMessageID: m.ID,
+	}
+	if tx := p.db.GORM().Create(&lastChange); tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (p *Processor) observeUserName(m discord.Message, id, name, kind string) error {
+	if _, ok := p.forgottenAccount(id); ok {
+		p.observeForgottenName(m, id, name, kind)
+		return nil
+	}
 	user, err := p.lookupUserID(id)
 	if err != nil {
 		return err
@@ -407,6 +1211,7 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 	var lastChange database.UserNameObservation
 	if tx := p.db.GORM().
 		Where("user_id = ?", id).
+		Where("kind = ?", kind).
 		Last(&lastChange); tx.Error == nil {
 		if lastChange.Name == name {
 			return nil // this nickname is already observed to be the latest one
@@ -420,16 +1225,28 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 		User:   user,
 		UserID: user.ID,
 		Name:   name,
+		Kind:   kind,
 		Time:   m.Timestamp,
+		Source: database.ObservationSourceMessage,
+
+		SourceImportID:  p.sourceImportID(),
+		SourceMessageID: m.ID,
 	}
 	if tx := p.db.GORM().Create(&lastChange); tx.Error != nil {
 		return tx.Error
 	}
 
+	// display names are not unique, so only usernames are trusted enough to
+	// fill in earlier records
+	if kind != database.NameKindUsername {
+		return nil
+	}
+
 	// find games up to this point that had the host user nulled but not the name
 	var games []*database.Game
 	if tx := p.db.GORM().
 		Where(`host_user_id IS NULL`).
+		Where(`host_user_ambiguous = ?`, false).
 		Where(`host_user_name = ?`, name).
 		Find(&games); tx.Error == nil {
 		if len(games) > 0 {
@@ -437,6 +1254,8 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 			for _, game := range games {
 				game.HostUser = &user
 				game.HostUserID = &user.ID
+				game.HostUserResolutionMethod = database.ResolutionLaterBackfill
+				game.HostUserResolutionConfidence = database.ConfidenceMedium
 				if tx := p.db.GORM().Save(game); tx.Error != nil {
 					return tx.Error
 				}
@@ -451,6 +1270,7 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 	games = []*database.Game{}
 	if tx := p.db.GORM().
 		Where(`winner_user_id IS NULL`).
+		Where(`winner_user_ambiguous = ?`, false).
 		Where(`winner_user_name = ?`, name).
 		Find(&games); tx.Error == nil {
 		if len(games) > 0 {
@@ -458,6 +1278,8 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 			for _, game := range games {
 				game.WinnerUser = &user
 				game.WinnerUserID = &user.ID
+				game.WinnerUserResolutionMethod = database.ResolutionLaterBackfill
+				game.WinnerUserResolutionConfidence = database.ConfidenceMedium
 				if tx := p.db.GORM().Save(game); tx.Error != nil {
 					return tx.Error
 				}
@@ -472,6 +1294,7 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 	var records []*database.InteractionUserMention
 	if tx := p.db.GORM().
 		Where(`user_id IS NULL`).
+		Where(`user_ambiguous = ?`, false).
 		Where(`user_name = ?`, name).
 		Find(&records); tx.Error == nil {
 		if len(records) > 0 {
@@ -479,6 +1302,8 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 			for _, record := range records {
 				record.User = &user
 				record.UserID = &user.ID
+				record.ResolutionMethod = database.ResolutionLaterBackfill
+				record.ResolutionConfidence = database.ConfidenceMedium
 				if tx := p.db.GORM().Save(record); tx.Error != nil {
 					return tx.Error
 				}
@@ -494,39 +1319,36 @@ func (p *Processor) observeUserName(m discord.Message, id, name string) error {
 	return nil
 }
 
-func (p *Processor) processExport(backup discord.Backup) error {
+func (p *Processor) processExport(source *database.ImportSource, backup discord.Backup) error {
+	p.source = source
+	defer func() { p.source = nil }()
+
 	for _, msg := range backup.Messages {
-		// in an attempt to collect up-to-message-date username changes, let's
-		// try to extract all possible hints
-		if msg.Interaction != nil {
-			// record interacted user
-			if err := p.observeUserName(msg, msg.Interaction.User.ID, msg.Interaction.User.Name); err != nil {
-				return err
-			}
-		}
-		if len(msg.Mentions) > 0 {
-			// record mentioned users
-			for _, mention := range msg.Mentions {
-				if err := p.observeUserName(msg, mention.ID, mention.Name); err != nil {
+		if resumeAfter, ok := p.resumeAfter[backup.Channel.ID]; ok && discord.CompareIDs(msg.ID, resumeAfter) <= 0 {
+			// names of forgotten users are only kept in memory and need to
+			// be learned again
+			for _, user := range messageUsers(msg) {
+				if _, ok := p.forgottenAccount(user.ID); !ok {
+					continue
+				}
+				if err := p.observeUser(msg, user); err != nil {
 					return err
 				}
 			}
+			continue
 		}
-		if len(msg.Reactions) > 0 {
-			// record reacting users
-			for _, reaction := range msg.Reactions {
-				for _, user := range reaction.Users {
-					if err := p.observeUserName(msg, user.ID, user.Name); err != nil {
-						return err
-					}
-				}
+
+		// in an attempt to collect up-to-message-date username changes, let's
+		// try to extract all possible hints
+		for _, user := range messageUsers(msg) {
+			if p.reprocessing {
+				continue
 			}
-		}
-		if msg.Author.ID != botAuthorID {
-			// record author user
-			if err := p.observeUserName(msg, msg.Author.ID, msg.Author.Name); err != nil {
+			if err := p.observeUser(msg, user); err != nil {
 				return err
 			}
+		}
+		if msg.Author.ID != botAuthorID {
 			continue
 		}
 		if len(msg.Embeds) < 1 {
@@ -555,7 +1377,7 @@ func (p *Processor) processExport(backup discord.Backup) error {
 					msg.Interaction != nil:
 				// extract recorded past nickname from responses to user-specific command
 				fields := strings.SplitN(embed.Author.Name, "'", 2)
-				if err := p.observeUserName(msg, msg.Interaction.User.ID, unescapeMarkdown(fields[0])); err != nil {
+				if err := p.observeUserName(msg, msg.Interaction.User.ID, markdown.Unescape(fields[0]), database.NameKindUsername); err != nil {
 					return err
 				}
 				break embedLoop
@@ -627,74 +1449,131 @@ func (p *Processor) processExport(backup discord.Backup) error {
 	return nil
 }
 
-const rxStrDiscordUsername = `([a-z0-9_\.\\]*[a-z0-9_\.])(\s+[^\*]+)?`
-
-var rxUserFormatted = regexp.MustCompile(
-	`(?:~~\*\*` + rxStrDiscordUsername + `\*\*~~|\*\*` + rxStrDiscordUsername + `\*\*)`)
+var (
+	// rxLegacyUserTag matches names of accounts that were not migrated to the
+	// new username system yet, e.g. "Name#1234".
+	rxLegacyUserTag       = regexp.MustCompile(`^(.+)#(\d{4})$`)
+	rxLegacyUserTagSuffix = regexp.MustCompile(`^(.+?#\d{4})(\s.*)?$`)
+	// rxUserNameSuffix matches a name in the new username format followed by
+	// an optional suffix.
+	rxUserNameSuffix = regexp.MustCompile(`^([a-z0-9_\.]+)(\s.*)?$`)
+)
 
-func unescapeMarkdown(msg string) string {
-	msg = strings.ReplaceAll(msg, `\_`, `_`)
-	msg = strings.ReplaceAll(msg, `\*`, `*`)
-	msg = strings.ReplaceAll(msg, `\.`, `.`)
-	msg = strings.ReplaceAll(msg, `\\`, `\`)
-	return msg
+// splitUserName splits the text of a formatted user mention into the name and
+// suffix. Names that users were observed with up to the time of the message
+// win over guessing by the name format, which only works for usernames and
+// legacy user tags but not display names which may contain spaces.
+func (p *Processor) splitUserName(m discord.Message, text string) (string, string, error) {
+	names := []string{text}
+	for i, r := range text {
+		if i > 0 && unicode.IsSpace(r) {
+			names = append(names, text[:i])
+		}
+	}
+	var knownNames []string
+	if tx := p.db.GORM().
+		Model(&database.UserNameObservation{}).
+		Distinct("name").
+		Where("name IN ?", names).
+		Where("time <= ?", m.Timestamp).
+		Pluck("name", &knownNames); tx.Error != nil {
+		return "", "", tx.Error
+	}
+	if len(knownNames) > 0 {
+		name := slices.MaxFunc(knownNames, func(a, b string) int {
+			return len(a) - len(b)
+		})
+		return name, text[len(name):], nil
+	}
+	if match := rxLegacyUserTagSuffix.FindStringSubmatch(text); match != nil {
+		return match[1], match[2], nil
+	}
+	if match := rxUserNameSuffix.FindStringSubmatch(text); match != nil {
+		return match[1], match[2], nil
+	}
+	return text, "", nil
 }
 
+// extractUsers replaces every user mention in msg, formatted as
+// ~~**USERNAME SUFFIX**~~ for killed users or **USERNAME SUFFIX** otherwise,
+// with a placeholder.
 func (p *Processor) extractUsers(m discord.Message, msg string) (string, []database.InteractionUserMention, error) {
-	matches := rxUserFormatted.FindAllStringSubmatch(msg, -1)
+	spans := markdown.Spans(msg)
 	userInteractions := []database.InteractionUserMention{}
-	for _, match := range matches {
-		var userInteraction database.InteractionUserMention
-		switch {
-		case len(match[1]) != 0: // ~~**USERNAME SUFFIX**~~
-			userName := unescapeMarkdown(match[1])
-			userInteraction = database.InteractionUserMention{
-				UserName: userName,
-				Killed:   true,
-				Suffix:   match[2],
-			}
-		case len(match[3]) != 0: // **USERNAME SUFFIX**
-			userName := unescapeMarkdown(match[3])
-			userInteraction = database.InteractionUserMention{
-				UserName: userName,
-				Suffix:   match[4],
-			}
+	var tmpl strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span.Kind != markdown.Bold {
+			continue
+		}
+		killed := slices.ContainsFunc(spans, func(s markdown.Span) bool {
+			return s.Kind == markdown.Strikethrough && s.Start == span.Start-2 && s.End == span.End+2
+		})
+		start, end := span.Start, span.End
+		if killed {
+			start, end = start-2, end+2
+		}
+		if start < last {
+			continue // nested within a previous mention
+		}
+
+		userName, suffix, err := p.splitUserName(m, span.Text)
+		if err != nil {
+			return msg, nil, err
+		}
+		userInteraction := database.InteractionUserMention{
+			UserName: userName,
+			Killed:   killed,
+			Suffix:   suffix,
 		}
 		index := slices.Index(userInteractions, userInteraction)
 		if index < 0 {
 			index = len(userInteractions)
 			userInteractions = append(userInteractions, userInteraction)
 		}
-		msg = strings.Replace(msg, match[0], fmt.Sprintf(`{{users[%d]}}`, index), 1)
+		tmpl.WriteString(msg[last:start])
+		tmpl.WriteString(template.UserPlaceholder(index))
+		last = end
 	}
+	tmpl.WriteString(msg[last:])
+	msg = tmpl.String()
+
 	// fill out users if possible
 	for i := range userInteractions {
-		user, err := p.lookupUserName(m, userInteractions[i].UserName)
+		resolution, err := p.lookupUserName(m, userInteractions[i].UserName)
 		if err != nil {
 			return msg, nil, err
 		}
-		if user != nil {
-			userInteractions[i].User = user
-			userInteractions[i].UserID = &user.ID
+		userInteractions[i].UserAmbiguous = resolution.Ambiguous
+		userInteractions[i].ResolutionMethod = resolution.Method
+		userInteractions[i].ResolutionConfidence = resolution.Confidence
+		if resolution.User != nil {
+			userInteractions[i].User = resolution.User
+			userInteractions[i].UserID = &resolution.User.ID
+		}
+		if len(resolution.Name) > 0 {
+			userInteractions[i].UserName = resolution.Name
 		}
 	}
 	return msg, userInteractions, nil
 }
 
-var rxItemFormatted = regexp.MustCompile(`__([^_]+)__`)
-
+// extractItems replaces the item mention in msg, formatted as __ITEM__, with
+// a placeholder.
 func (p *Processor) extractItems(msg string) (string, []database.Item, error) {
-	matches := rxItemFormatted.FindAllStringSubmatch(msg, -1)
+	spans := slices.DeleteFunc(markdown.Spans(msg), func(s markdown.Span) bool {
+		return s.Kind != markdown.Underline
+	})
 	items := []database.Item{}
-	if len(matches) > 1 {
+	if len(spans) > 1 {
 		return "", nil, errors.New("more than 1 item mention found in message which is not yet supported: " + msg)
 	}
-	for _, match := range matches {
-		item, err := p.lookupItem(unescapeMarkdown(match[1]))
+	for _, span := range spans {
+		item, err := p.lookupItem(span.Text)
 		if err != nil {
 			return "", nil, err
 		}
-		msg = strings.Replace(msg, match[0], `{{item}}`, 1)
+		msg = msg[:span.Start] + template.ItemPlaceholder + msg[span.End:]
 		items = append(items, item)
 	}
 	return msg, items, nil
@@ -717,15 +1596,24 @@ func (p *Processor) createNewGame(c discord.Channel, m discord.Message, era stri
 		Era:              era,
 		HostUserName:     hostName,
 		DiscordChannelID: c.ID,
+
+		SourceImportID:  p.sourceImportID(),
+		SourceMessageID: m.ID,
 	}
 	if hostName != nil {
-		hostUser, err := p.lookupUserName(m, *hostName)
+		resolution, err := p.lookupUserName(m, *hostName)
 		if err != nil {
 			return err
 		}
-		if hostUser != nil {
-			cs.LastKnownGame.HostUser = hostUser
-			cs.LastKnownGame.HostUserID = &hostUser.ID
+		cs.LastKnownGame.HostUserAmbiguous = resolution.Ambiguous
+		cs.LastKnownGame.HostUserResolutionMethod = resolution.Method
+		cs.LastKnownGame.HostUserResolutionConfidence = resolution.Confidence
+		if resolution.User != nil {
+			cs.LastKnownGame.HostUser = resolution.User
+			cs.LastKnownGame.HostUserID = &resolution.User.ID
+		}
+		if len(resolution.Name) > 0 {
+			cs.LastKnownGame.HostUserName = &resolution.Name
 		}
 	}
 	cs.LastKnownRound = database.Round{
@@ -766,7 +1654,7 @@ func (p *Processor) processGameCountdownStart(c discord.Channel, m discord.Messa
 	// find host
 	var hostUserName *string
 	if fields := strings.SplitN(cleanTitle, " hosted by ", 2); len(fields) == 2 {
-		username := unescapeMarkdown(fields[1])
+		username := markdown.Unescape(fields[1])
 		hostUserName = &username
 	}
 
@@ -821,6 +1709,9 @@ func (p *Processor) processGameWinner(c discord.Channel, m discord.Message, e di
 	cs.LastKnownGame.WinnerUserName = &userMentions[0].UserName
 	cs.LastKnownGame.WinnerUserID = userMentions[0].UserID
 	cs.LastKnownGame.WinnerUser = userMentions[0].User
+	cs.LastKnownGame.WinnerUserAmbiguous = userMentions[0].UserAmbiguous
+	cs.LastKnownGame.WinnerUserResolutionMethod = userMentions[0].ResolutionMethod
+	cs.LastKnownGame.WinnerUserResolutionConfidence = userMentions[0].ResolutionConfidence
 	cs.LastKnownGame.DiscordEndMessageID = m.ID
 
 	// record game finish timestamp
@@ -902,12 +1793,14 @@ func (p *Processor) processRound(c discord.Channel, m discord.Message, e discord
 	// log.Printf("Round (STD): %+v\n", p.LastKnownRound)
 	cs.LastKnownRound.DiscordMessageID = m.ID
 	cs.LastKnownRound.PostTime = m.Timestamp
+	cs.LastKnownRound.SourceImportID = p.sourceImportID()
 	if err := p.storeCurrentRound(c); err != nil {
 		return err
 	}
 
-	for _, line := range rxInteraction.FindAllStringSubmatch(e.Description, -1) {
-		line, userInteractions, err := p.extractUsers(m, line[2])
+	for _, loc := range rxInteraction.FindAllStringSubmatchIndex(e.Description, -1) {
+		lineIndex := strings.Count(e.Description[:loc[0]], "\n")
+		line, userInteractions, err := p.extractUsers(m, e.Description[loc[4]:loc[5]])
 		if err != nil {
 			return err
 		}
@@ -919,6 +1812,12 @@ func (p *Processor) processRound(c discord.Channel, m discord.Message, e discord
 		if err != nil {
 			return err
 		}
+		slots := template.Slots(interactionMessage)
+		for n := range userInteractions {
+			if slotIndex, ok := template.SlotIndex(slots, template.UserPlaceholder(n)); ok {
+				userInteractions[n].SlotIndex = &slotIndex
+			}
+		}
 		i := database.Interaction{
 			Message:      interactionMessage,
 			MessageID:    interactionMessage.ID,
@@ -926,6 +1825,10 @@ func (p *Processor) processRound(c discord.Channel, m discord.Message, e discord
 			RoundID:      cs.LastKnownRound.ID,
 			UserMentions: userInteractions,
 			Items:        items,
+
+			SourceImportID:  p.sourceImportID(),
+			SourceMessageID: m.ID,
+			SourceLineIndex: lineIndex,
 		}
 		if err := p.storeInteraction(&i); err != nil {
 			return err
@@ -1007,6 +1910,7 @@ func (p *Processor) processEventRound(c discord.Channel, m discord.Message, e di
 	// log.Printf("Round (EVENT): %+v\n", p.LastKnownRound)
 	cs.LastKnownRound.DiscordMessageID = m.ID
 	cs.LastKnownRound.PostTime = m.Timestamp
+	cs.LastKnownRound.SourceImportID = p.sourceImportID()
 	if err := p.storeCurrentRound(c); err != nil {
 		return err
 	}
@@ -1028,6 +1932,11 @@ func (p *Processor) processEventRound(c discord.Channel, m discord.Message, e di
 	if err != nil {
 		return err
 	}
+	// listed users all fill the event's only slot
+	listedSlot := 0
+	for n := range userInteractions {
+		userInteractions[n].SlotIndex = &listedSlot
+	}
 	i := database.Interaction{
 		Message:      interactionMessage,
 		MessageID:    interactionMessage.ID,
@@ -1035,6 +1944,9 @@ func (p *Processor) processEventRound(c discord.Channel, m discord.Message, e di
 		RoundID:      cs.LastKnownRound.ID,
 		UserMentions: userInteractions,
 		Items:        items,
+
+		SourceImportID:  p.sourceImportID(),
+		SourceMessageID: m.ID,
 	}
 	if err := p.storeInteraction(&i); err != nil {
 		return err
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+// splitDumpManifestFile is the manifest's name within a split dump.
+const splitDumpManifestFile = "manifest.json"
+
+// dumpManifest describes a dump for tools that should not need to parse it.
+type dumpManifest struct {
+	SchemaVersion  int              `json:"schema_version"`
+	Dialect        string           `json:"dialect"`
+	Pseudonymized  bool             `json:"pseudonymized,omitempty"`
+	LatestGameTime *time.Time       `json:"latest_game_time"`
+	FirstGameID    *int             `json:"first_game_id"`
+	LastGameID     *int             `json:"last_game_id"`
+	Rows           map[string]int64 `json:"rows"`
+	Sources        []dumpSource     `json:"sources"`
+	// SHA256 is the checksum of a single file dump.
+	SHA256 string `json:"sha256,omitempty"`
+	// Files lists the files of a split dump in the order they need to be
+	// loaded in.
+	Files []dumpFile `json:"files,omitempty"`
+}
+
+// dumpSource is an export file the data in the dump was imported from.
+type dumpSource struct {
+	Path       string    `json:"path"`
+	Checksum   string    `json:"checksum"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+type dumpFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// newDumpManifest collects everything about the database that goes into the
+// manifest, apart from checksums of the dump itself.
+func newDumpManifest(db *database.Database, schemaVersion int, dialect string, pseudonymized bool, latestGameTime time.Time) (*dumpManifest, error) {
+	manifest := &dumpManifest{
+		SchemaVersion: schemaVersion,
+		Dialect:       dialect,
+		Pseudonymized: pseudonymized,
+		Sources:       []dumpSource{},
+	}
+	if !latestGameTime.IsZero() {
+		manifest.LatestGameTime = &latestGameTime
+	}
+
+	var gameIDs struct {
+		First *int
+		Last  *int
+	}
+	if tx := db.GORM().Model(&database.Game{}).
+		Select("MIN(id) AS first, MAX(id) AS last").
+		Scan(&gameIDs); tx.Error != nil {
+		return nil, tx.Error
+	}
+	manifest.FirstGameID = gameIDs.First
+	manifest.LastGameID = gameIDs.Last
+
+	rows, err := db.RowCounts()
+	if err != nil {
+		return nil, err
+	}
+	manifest.Rows = rows
+
+	var sources []database.ImportSource
+	if tx := db.GORM().Order("path").Order("id").Find(&sources); tx.Error != nil {
+		return nil, tx.Error
+	}
+	for _, source := range sources {
+		manifest.Sources = append(manifest.Sources, dumpSource{
+			Path:       source.Path,
+			Checksum:   source.Checksum,
+			ExportedAt: source.ExportedAt,
+		})
+	}
+	return manifest, nil
+}
+
+// loadDumpManifest reads a manifest written by the dump subcommand.
+func loadDumpManifest(path string) (*dumpManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	manifest := &dumpManifest{}
+	if err := json.NewDecoder(f).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid dump manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+func (m *dumpManifest) save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("failed to write dump manifest: %w", err)
+	}
+	return f.Close()
+}
+
+// hashingWriter calculates the SHA-256 of everything written through it.
+type hashingWriter struct {
+	io.Writer
+	hash hash.Hash
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	h := sha256.New()
+	return &hashingWriter{
+		Writer: io.MultiWriter(w, h),
+		hash:   h,
+	}
+}
+
+func (w *hashingWriter) sum() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
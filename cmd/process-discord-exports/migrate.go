@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+func runMigrate(db *database.Database, args []string) error {
+	if len(args) == 0 {
+		return errors.New("need one of up, down or status")
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	to := flags.Int("to", -1, "schema `VERSION` to migrate to, defaults to the latest for up and the previous for down")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		if *to < 0 {
+			err = db.Migrate()
+		} else {
+			err = db.MigrateUp(*to)
+		}
+	case "down":
+		// only revert the latest migration unless told otherwise
+		if *to < 0 {
+			*to = version - 1
+		}
+		err = db.MigrateDown(max(*to, 0))
+	case "status":
+		return printMigrationStatus(db)
+	default:
+		return fmt.Errorf("invalid migrate command: %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	newVersion, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if newVersion == version {
+		log.Printf("Schema is at version %d, nothing to do", version)
+	} else {
+		log.Printf("Migrated schema from version %d to %d", version, newVersion)
+	}
+	return nil
+}
+
+func printMigrationStatus(db *database.Database) error {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, migration := range status {
+		applied := "pending"
+		if migration.AppliedAt != nil {
+			applied = migration.AppliedAt.Format(time.RFC3339)
+		} else if migration.Applied {
+			applied = "unknown"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, applied)
+	}
+	return w.Flush()
+}
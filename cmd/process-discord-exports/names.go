@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+type nameHistoryEntry struct {
+	Time   time.Time  `json:"time"`
+	Name   string     `json:"name"`
+	Kind   string     `json:"kind"`
+	Source string     `json:"source"`
+	Until  *time.Time `json:"valid_until,omitempty"`
+	Note   string     `json:"note,omitempty"`
+	Link   string     `json:"link,omitempty"`
+}
+
+type nameHistory struct {
+	UserID string             `json:"user_id"`
+	Names  []nameHistoryEntry `json:"names"`
+}
+
+type nameHolder struct {
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind"`
+	// From is when the user was first seen with the name, Until when the
+	// user was first seen with another name, if ever.
+	From   time.Time  `json:"from"`
+	Until  *time.Time `json:"until,omitempty"`
+	Source string     `json:"source"`
+	Link   string     `json:"link,omitempty"`
+}
+
+type nameHolders struct {
+	Name  string       `json:"name"`
+	Users []nameHolder `json:"users"`
+}
+
+// observationLink returns the link to the message a name was observed in, if
+// any.
+func observationLink(o database.UserNameObservation) string {
+	if o.SourceImport == nil || len(o.SourceMessageID) == 0 {
+		return ""
+	}
+	return messageLink(o.SourceImport.ChannelID, o.SourceMessageID)
+}
+
+func runNames(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("names", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("need exactly one user ID or name")
+	}
+	query := flags.Arg(0)
+
+	// anything that is a known user ID is looked up as such, since names
+	// could technically look like IDs as well
+	var user database.User
+	tx := db.GORM().Where("id = ?", query).Limit(1).Find(&user)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	var result any
+	var err error
+	if tx.RowsAffected > 0 {
+		result, err = userNameHistory(db, user.ID)
+	} else {
+		result, err = nameHolderHistory(db, query)
+	}
+	if err != nil {
+		return err
+	}
+	// fail the same way no matter the output format
+	if holders, ok := result.(*nameHolders); ok && len(holders.Users) == 0 {
+		return fmt.Errorf("nobody was ever seen with the name %s", holders.Name)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	switch result := result.(type) {
+	case *nameHistory:
+		fmt.Fprintln(w, "FIRST SEEN\tNAME\tKIND\tSOURCE\tLINK")
+		for _, entry := range result.Names {
+			link := entry.Link
+			if len(link) == 0 {
+				link = entry.Note
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Time.Format(time.RFC3339), entry.Name, entry.Kind, entry.Source, link)
+		}
+	case *nameHolders:
+		fmt.Fprintln(w, "USER ID\tKIND\tFROM\tUNTIL\tSOURCE\tLINK")
+		for _, holder := range result.Users {
+			until := "-"
+			if holder.Until != nil {
+				until = holder.Until.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", holder.UserID, holder.Kind, holder.From.Format(time.RFC3339), until, holder.Source, holder.Link)
+		}
+	}
+	return w.Flush()
+}
+
+// userNameHistory returns every name the user was observed with in the order
+// they were first seen.
+func userNameHistory(db *database.Database, userID string) (*nameHistory, error) {
+	var observations []database.UserNameObservation
+	if tx := db.GORM().
+		Preload("SourceImport").
+		Where("user_id = ?", userID).
+		Order("time").
+		Order("id").
+		Find(&observations); tx.Error != nil {
+		return nil, tx.Error
+	}
+	history := &nameHistory{
+		UserID: userID,
+		Names:  []nameHistoryEntry{},
+	}
+	for _, o := range observations {
+		history.Names = append(history.Names, nameHistoryEntry{
+			Time:   o.Time,
+			Name:   o.Name,
+			Kind:   o.Kind,
+			Source: o.Source,
+			Until:  o.ValidUntil,
+			Note:   o.Note,
+			Link:   observationLink(o),
+		})
+	}
+	return history, nil
+}
+
+// nameHolderHistory returns every user who held the name along with the
+// time ranges they held it in.
+func nameHolderHistory(db *database.Database, name string) (*nameHolders, error) {
+	var observations []database.UserNameObservation
+	if tx := db.GORM().
+		Preload("SourceImport").
+		Where("user_id IN (?)", db.GORM().
+			Model(&database.UserNameObservation{}).
+			Distinct("user_id").
+			Where("name = ?", name)).
+		Order("user_id").
+		Order("kind").
+		Order("time").
+		Order("id").
+		Find(&observations); tx.Error != nil {
+		return nil, tx.Error
+	}
+	holders := &nameHolders{
+		Name:  name,
+		Users: []nameHolder{},
+	}
+	for i, o := range observations {
+		if o.Name != name {
+			continue
+		}
+		holder := nameHolder{
+			UserID: o.UserID,
+			Kind:   o.Kind,
+			From:   o.Time,
+			Until:  o.ValidUntil,
+			Source: o.Source,
+			Link:   observationLink(o),
+		}
+		// the name was held until the next name of the same kind showed up
+		if holder.Until == nil && i+1 < len(observations) &&
+			observations[i+1].UserID == o.UserID && observations[i+1].Kind == o.Kind {
+			holder.Until = &observations[i+1].Time
+		}
+		holders.Users = append(holders.Users, holder)
+	}
+	return holders, nil
+}
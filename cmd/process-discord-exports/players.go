@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/players"
+	"gorm.io/gorm"
+)
+
+func playersFilePath() string {
+	if len(playersPath) > 0 {
+		return playersPath
+	}
+	return filepath.Join(exportsPath, "players.yml")
+}
+
+// playerID returns the player a new user belongs to, creating a player of its
+// own for accounts that are not listed in the player file.
+func (p *Processor) playerID(userID string) (int, error) {
+	if id, ok := p.playerIDs[userID]; ok {
+		return id, nil
+	}
+	player := database.Player{}
+	if tx := p.db.GORM().Create(&player); tx.Error != nil {
+		return 0, tx.Error
+	}
+	return player.ID, nil
+}
+
+// importPlayers creates the players from the player file and moves users that
+// were kept from a previous import to their current player.
+func (p *Processor) importPlayers() error {
+	path := playersFilePath()
+	file, err := players.Load(path)
+	if err != nil {
+		return err
+	}
+
+	p.playerIDs = map[string]int{}
+	for _, player := range file.Players {
+		row := database.Player{Name: &player.Name}
+		if tx := p.db.GORM().
+			Where("name = ?", player.Name).
+			FirstOrCreate(&row); tx.Error != nil {
+			return tx.Error
+		}
+		for _, account := range player.Accounts {
+			if _, ok := p.forgottenAccount(account); ok {
+				log.Printf("WARNING: Ignoring forgotten account %s of player %s", account, player.Name)
+				continue
+			}
+			p.playerIDs[account] = row.ID
+		}
+	}
+
+	var users []database.User
+	if tx := p.db.GORM().Preload("Player").Find(&users); tx.Error != nil {
+		return tx.Error
+	}
+	for _, user := range users {
+		playerID, linked := p.playerIDs[user.ID]
+		switch {
+		case linked && (user.PlayerID == nil || *user.PlayerID != playerID):
+			// linked since the last import
+		case !linked && (user.Player == nil || user.Player.Name != nil):
+			// unlinked since the last import
+			if playerID, err = p.playerID(user.ID); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		if tx := p.db.GORM().
+			Model(&database.User{}).
+			Where("id = ?", user.ID).
+			Update("player_id", playerID); tx.Error != nil {
+			return tx.Error
+		}
+	}
+
+	// make sure every linked account exists so its player is not dropped below
+	for account := range p.playerIDs {
+		// never store the ID of a forgotten account
+		if _, ok := p.forgottenAccount(account); ok {
+			continue
+		}
+		if _, err := p.lookupUserID(account); err != nil {
+			return err
+		}
+	}
+
+	if err := deleteUnusedPlayers(p.db.GORM()); err != nil {
+		return err
+	}
+
+	if len(file.Players) > 0 {
+		log.Printf("Loaded %d players from %s", len(file.Players), path)
+	}
+	return nil
+}
+
+// deleteUnusedPlayers drops players nobody belongs to anymore.
+func deleteUnusedPlayers(db *gorm.DB) error {
+	if tx := db.
+		Where("id NOT IN (?)", db.
+			Model(&database.User{}).
+			Select("player_id").
+			Where("player_id IS NOT NULL")).
+		Delete(&database.Player{}); tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+// updatePlayers changes the player file and applies it to the database.
+func updatePlayers(db *database.Database, change func(*Processor, *players.File) error) error {
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	p := newProcessor(db)
+	if err := p.importOptOut(); err != nil {
+		return err
+	}
+
+	path := playersFilePath()
+	file, err := players.Load(path)
+	if err != nil {
+		return err
+	}
+	if err := change(p, file); err != nil {
+		return err
+	}
+	if err := file.Save(path); err != nil {
+		return err
+	}
+	return p.importPlayers()
+}
+
+func runLinkAccounts(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("link-accounts", flag.ExitOnError)
+	name := flags.String("player", "", "`NAME` of the player to link the accounts to")
+	note := flags.String("note", "", "note on the player, e.g. how the accounts are known to belong together")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("need at least one user ID to link")
+	}
+
+	return updatePlayers(db, func(p *Processor, file *players.File) error {
+		for _, account := range flags.Args() {
+			if _, ok := p.forgottenAccount(account); ok {
+				return fmt.Errorf("account %s is on the opt-out list and can not be linked", account)
+			}
+		}
+		if err := file.Link(*name, flags.Args()...); err != nil {
+			return err
+		}
+		if len(*note) > 0 {
+			file.PlayerOf(flags.Arg(0)).Note = *note
+		}
+		log.Printf("Linked %d accounts to player %s", flags.NArg(), *name)
+		return nil
+	})
+}
+
+func runUnlinkAccounts(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("unlink-accounts", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("need at least one user ID to unlink")
+	}
+
+	return updatePlayers(db, func(_ *Processor, file *players.File) error {
+		if err := file.Unlink(flags.Args()...); err != nil {
+			return err
+		}
+		log.Printf("Unlinked %d accounts", flags.NArg())
+		return nil
+	})
+}
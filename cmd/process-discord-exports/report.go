@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+// messageLink returns the URL of a Discord message in the fan server.
+func messageLink(channelID, messageID string) string {
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
+
+type unresolvedName struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Ambiguous   bool   `json:"ambiguous"`
+	Count       int    `json:"count"`
+	ExampleLink string `json:"example_link"`
+
+	ChannelID string `json:"-"`
+	MessageID string `json:"-"`
+}
+
+type resolutionSummary struct {
+	Kind       string `json:"kind"`
+	Method     string `json:"method"`
+	Confidence string `json:"confidence"`
+	Count      int    `json:"count"`
+}
+
+type resolutionReport struct {
+	Summary    []resolutionSummary `json:"summary"`
+	Unresolved []unresolvedName    `json:"unresolved"`
+}
+
+// unresolvedNamesQuery lists every name that could not be resolved to a user
+// with the earliest message it appeared in. Message IDs are compared as
+// numbers since they differ in length.
+const unresolvedNamesQuery = `
+SELECT name, kind, ambiguous, COUNT(*) AS count, channel_id, MIN(CAST(message_id AS INTEGER)) AS message_id
+FROM (
+	SELECT um.user_name AS name, 'mention' AS kind, um.user_ambiguous AS ambiguous,
+		g.discord_channel_id AS channel_id, r.discord_message_id AS message_id
+	FROM interaction_user_mentions um
+	JOIN interaction_user_mention_mappings umm ON umm.interaction_user_mention_id = um.id
+	JOIN interactions i ON i.id = umm.interaction_id
+	JOIN rounds r ON r.id = i.round_id
+	JOIN games g ON g.id = r.game_id
+	WHERE um.user_id IS NULL
+	UNION ALL
+	SELECT host_user_name, 'host', host_user_ambiguous, discord_channel_id, source_message_id
+	FROM games
+	WHERE host_user_name IS NOT NULL AND host_user_id IS NULL
+	UNION ALL
+	SELECT winner_user_name, 'winner', winner_user_ambiguous, discord_channel_id, discord_end_message_id
+	FROM games
+	WHERE winner_user_name IS NOT NULL AND winner_user_id IS NULL
+)
+GROUP BY name, kind, ambiguous
+ORDER BY count DESC, name, kind`
+
+const resolutionSummaryQuery = `
+SELECT 'mention' AS kind, resolution_method AS method, resolution_confidence AS confidence, COUNT(*) AS count
+FROM interaction_user_mentions
+GROUP BY resolution_method, resolution_confidence
+UNION ALL
+SELECT 'host', host_user_resolution_method, host_user_resolution_confidence, COUNT(*)
+FROM games
+WHERE host_user_name IS NOT NULL
+GROUP BY host_user_resolution_method, host_user_resolution_confidence
+UNION ALL
+SELECT 'winner', winner_user_resolution_method, winner_user_resolution_confidence, COUNT(*)
+FROM games
+WHERE winner_user_name IS NOT NULL
+GROUP BY winner_user_resolution_method, winner_user_resolution_confidence
+ORDER BY kind, count DESC`
+
+func runResolutionReport(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("resolution-report", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report := resolutionReport{
+		Summary:    []resolutionSummary{},
+		Unresolved: []unresolvedName{},
+	}
+	if tx := db.GORM().Raw(resolutionSummaryQuery).Scan(&report.Summary); tx.Error != nil {
+		return tx.Error
+	}
+	if tx := db.GORM().Raw(unresolvedNamesQuery).Scan(&report.Unresolved); tx.Error != nil {
+		return tx.Error
+	}
+	for i, name := range report.Unresolved {
+		report.Unresolved[i].ExampleLink = messageLink(name.ChannelID, name.MessageID)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tMETHOD\tCONFIDENCE\tCOUNT")
+	for _, s := range report.Summary {
+		method := s.Method
+		if len(method) == 0 {
+			method = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", s.Kind, method, s.Confidence, s.Count)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "NAME\tKIND\tSTATUS\tCOUNT\tEXAMPLE")
+	for _, name := range report.Unresolved {
+		status := "unresolved"
+		if name.Ambiguous {
+			status = "ambiguous"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", name.Name, name.Kind, status, name.Count, name.ExampleLink)
+	}
+	return w.Flush()
+}
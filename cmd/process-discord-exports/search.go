@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+type searchResult struct {
+	InteractionID int       `json:"interaction_id"`
+	GameID        int       `json:"game_id"`
+	RoundNumber   int       `json:"round_number"`
+	PostTime      time.Time `json:"post_time"`
+	Event         string    `json:"event"`
+	Text          string    `json:"text"`
+	Items         []string  `json:"items"`
+	Users         []string  `json:"users"`
+	Link          string    `json:"link,omitempty"`
+}
+
+// searchRow is a row of interaction_details with lists still joined by ";".
+type searchRow struct {
+	InteractionID   int
+	GameID          int
+	RoundNumber     int
+	PostTime        time.Time
+	Event           string
+	Text            string
+	Items           *string
+	Users           *string
+	ChannelID       *string
+	SourceMessageID *string
+}
+
+// ftsQuery turns search terms into an FTS5 query matching all of them, each
+// as a phrase so that no term is taken for query syntax.
+func ftsQuery(terms []string) string {
+	phrases := []string{}
+	for _, term := range terms {
+		phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(phrases, " ")
+}
+
+// splitList splits a list joined by ";" as found in the views.
+func splitList(s *string) []string {
+	if s == nil || len(*s) == 0 {
+		return []string{}
+	}
+	return strings.Split(*s, ";")
+}
+
+func runSearch(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output as JSON")
+	limit := flags.Int("limit", 100, "maximum number of results")
+	raw := flags.Bool("raw", false, "pass the terms on as FTS5 query syntax")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("need at least one search term")
+	}
+	query := ftsQuery(flags.Args())
+	if *raw {
+		query = strings.Join(flags.Args(), " ")
+	}
+
+	// templates and event titles are matched through the interaction's
+	// message, item names through the items mentioned in the interaction
+	var rows []searchRow
+	if tx := db.GORM().Raw(`SELECT
+			d.interaction_id, d.game_id, d.round_number, d.post_time, d.event, d.text, d.items, d.users,
+			s.channel_id, i.source_message_id
+		FROM interaction_details d
+		JOIN interactions i ON i.id = d.interaction_id
+		LEFT JOIN import_sources s ON s.id = i.source_import_id
+		WHERE i.message_id IN (
+			SELECT rowid FROM interaction_messages_fts WHERE interaction_messages_fts MATCH @query
+		) OR i.id IN (
+			SELECT im.interaction_id FROM interaction_item_mappings im
+			WHERE im.item_name IN (SELECT name FROM items_fts WHERE items_fts MATCH @query)
+		)
+		ORDER BY d.post_time, d.interaction_id
+		LIMIT @limit`,
+		map[string]any{"query": query, "limit": *limit}).
+		Scan(&rows); tx.Error != nil {
+		return fmt.Errorf("search failed: %w", tx.Error)
+	}
+
+	results := []searchResult{}
+	for _, row := range rows {
+		result := searchResult{
+			InteractionID: row.InteractionID,
+			GameID:        row.GameID,
+			RoundNumber:   row.RoundNumber,
+			PostTime:      row.PostTime,
+			Event:         row.Event,
+			Text:          row.Text,
+			Items:         splitList(row.Items),
+			Users:         splitList(row.Users),
+		}
+		if row.ChannelID != nil && row.SourceMessageID != nil && len(*row.SourceMessageID) > 0 {
+			result.Link = messageLink(*row.ChannelID, *row.SourceMessageID)
+		}
+		results = append(results, result)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	if len(results) == 0 {
+		return fmt.Errorf("no interactions match %s", query)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// templates can span several lines, which would break the table
+	oneLine := strings.NewReplacer("\r", "", "\n", " ")
+	fmt.Fprintln(w, "TIME\tGAME\tROUND\tEVENT\tTEXT\tITEMS\tUSERS\tLINK")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			result.PostTime.Format(time.RFC3339), result.GameID, result.RoundNumber, result.Event, oneLine.Replace(result.Text),
+			strings.Join(result.Items, ", "), strings.Join(result.Users, ", "), result.Link)
+	}
+	return w.Flush()
+}
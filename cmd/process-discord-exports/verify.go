@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/discord"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/optout"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/template"
+)
+
+// Problems found when verifying interactions against their source lines.
+const (
+	// verifyMismatch means the rendered interaction differs from the line.
+	verifyMismatch = "mismatch"
+	// verifyRenderFailed means the interaction could not be rendered at all,
+	// e.g. because a slot is filled by several users.
+	verifyRenderFailed = "render-failed"
+	// verifyMissingLine means the line the interaction was parsed from is not
+	// in the export anymore.
+	verifyMissingLine = "missing-line"
+	// verifyNotStored means a line of a round has no interaction.
+	verifyNotStored = "not-stored"
+)
+
+type verifyProblem struct {
+	Problem       string `json:"problem"`
+	InteractionID *int   `json:"interaction_id,omitempty"`
+	Source        string `json:"source"`
+	MessageID     string `json:"message_id"`
+	LineIndex     int    `json:"line_index"`
+	Line          string `json:"line,omitempty"`
+	Rendered      string `json:"rendered,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Link          string `json:"link"`
+}
+
+type verifyReport struct {
+	Sources      int `json:"sources"`
+	Interactions int `json:"interactions"`
+	// Skipped counts interactions mentioning forgotten users, whose names
+	// were replaced on purpose.
+	Skipped  int             `json:"skipped"`
+	Problems []verifyProblem `json:"problems"`
+}
+
+// sourceLine is a line of a round embed as matched by rxInteraction.
+type sourceLine struct {
+	index int
+	text  string
+}
+
+// roundLines returns the interaction lines of the message's round embeds
+// along with their zero-based line index, the same way processRound finds
+// them. For event rounds these are the lines listing users.
+func roundLines(m discord.Message) []sourceLine {
+	lines := []sourceLine{}
+	for _, e := range m.Embeds {
+		if !strings.HasPrefix(e.Title, "__Round ") {
+			continue
+		}
+		for _, loc := range rxInteraction.FindAllStringSubmatchIndex(e.Description, -1) {
+			lines = append(lines, sourceLine{
+				index: strings.Count(e.Description[:loc[0]], "\n"),
+				text:  e.Description[loc[4]:loc[5]],
+			})
+		}
+	}
+	return lines
+}
+
+func runVerify(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var sources []database.ImportSource
+	if tx := db.GORM().Find(&sources); tx.Error != nil {
+		return tx.Error
+	}
+	sourcesByPath := map[string][]database.ImportSource{}
+	for _, source := range sources {
+		sourcesByPath[source.Path] = append(sourcesByPath[source.Path], source)
+	}
+
+	var allSlots []database.TemplateSlot
+	if tx := db.GORM().Order("message_id").Order("slot_index").Find(&allSlots); tx.Error != nil {
+		return tx.Error
+	}
+	slots := map[int][]database.TemplateSlot{}
+	for _, slot := range allSlots {
+		slots[slot.MessageID] = append(slots[slot.MessageID], slot)
+	}
+
+	exportFiles, err := findExportFiles(shoppingChannelID, mainChannelID)
+	if err != nil {
+		return err
+	}
+	report := verifyReport{Problems: []verifyProblem{}}
+	for _, exportFile := range exportFiles {
+		path := importSourcePath(exportFile.Path)
+		if len(sourcesByPath[path]) == 0 {
+			continue
+		}
+		backup, checksum, err := readBackup(exportFile)
+		if err != nil {
+			return err
+		}
+		for _, source := range sourcesByPath[path] {
+			if source.Checksum != checksum {
+				continue
+			}
+			if err := verifySource(db, source, backup, slots, &report); err != nil {
+				return err
+			}
+			report.Sources++
+		}
+	}
+	if report.Sources < len(sources) {
+		log.Printf("WARNING: Only %d of %d import sources were found in %s", report.Sources, len(sources), exportsPath)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range report.Problems {
+			fmt.Printf("%s: %s line %d (%s)\n", problem.Problem, problem.Source, problem.LineIndex, problem.Link)
+			if len(problem.Line) > 0 {
+				fmt.Printf("  line:     %s\n", problem.Line)
+			}
+			if len(problem.Rendered) > 0 {
+				fmt.Printf("  rendered: %s\n", problem.Rendered)
+			}
+			if len(problem.Error) > 0 {
+				fmt.Printf("  error:    %s\n", problem.Error)
+			}
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("found %d problems verifying %d interactions from %d exports", len(report.Problems), report.Interactions, report.Sources)
+	}
+	log.Printf("Verified %d interactions from %d exports, skipped %d mentioning forgotten users", report.Interactions, report.Sources, report.Skipped)
+	return nil
+}
+
+// verifySource renders every interaction parsed from a round of the export
+// and compares it with the line it was parsed from, or for events every user
+// listed with the line listing them. Lines of messages that interactions were
+// parsed from are expected to all have an interaction or listed user.
+func verifySource(db *database.Database, source database.ImportSource, backup discord.Backup, slots map[int][]database.TemplateSlot, report *verifyReport) error {
+	var interactions []database.Interaction
+	if tx := db.GORM().
+		Preload("Message").
+		Preload("UserMentions").
+		Preload("Items").
+		Where("source_import_id = ?", source.ID).
+		Order("id").
+		Find(&interactions); tx.Error != nil {
+		return tx.Error
+	}
+
+	lines := map[string][]sourceLine{}
+	for _, m := range backup.Messages {
+		lines[m.ID] = roundLines(m)
+	}
+
+	stored := map[string]map[int]bool{}
+	for _, i := range interactions {
+		if stored[i.SourceMessageID] == nil {
+			stored[i.SourceMessageID] = map[int]bool{}
+		}
+		event := len(i.Message.Event) > 0
+		if event {
+			for _, line := range lines[i.SourceMessageID] {
+				stored[i.SourceMessageID][line.index] = true
+			}
+		} else {
+			stored[i.SourceMessageID][i.SourceLineIndex] = true
+		}
+		if slices.ContainsFunc(i.UserMentions, func(mention database.InteractionUserMention) bool {
+			return mention.UserID != nil && optout.IsPseudonym(*mention.UserID)
+		}) {
+			report.Skipped++
+			continue
+		}
+		report.Interactions++
+
+		problem := verifyProblem{
+			InteractionID: &i.ID,
+			Source:        source.Path,
+			MessageID:     i.SourceMessageID,
+			LineIndex:     i.SourceLineIndex,
+			Link:          messageLink(source.ChannelID, i.SourceMessageID),
+		}
+		if event {
+			verifyEventUsers(i, lines[i.SourceMessageID], problem, report)
+			continue
+		}
+		n := slices.IndexFunc(lines[i.SourceMessageID], func(line sourceLine) bool {
+			return line.index == i.SourceLineIndex
+		})
+		if n < 0 {
+			problem.Problem = verifyMissingLine
+			report.Problems = append(report.Problems, problem)
+			continue
+		}
+		problem.Line = lines[i.SourceMessageID][n].text
+		rendered, err := template.Render(i.Message, slots[i.MessageID], i.UserMentions, i.Items)
+		if err != nil {
+			problem.Problem = verifyRenderFailed
+			problem.Error = err.Error()
+			report.Problems = append(report.Problems, problem)
+			continue
+		}
+		if rendered != problem.Line {
+			problem.Problem = verifyMismatch
+			problem.Rendered = rendered
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	for _, m := range backup.Messages {
+		if stored[m.ID] == nil {
+			continue
+		}
+		for _, line := range lines[m.ID] {
+			if stored[m.ID][line.index] {
+				continue
+			}
+			report.Problems = append(report.Problems, verifyProblem{
+				Problem:   verifyNotStored,
+				Source:    source.Path,
+				MessageID: m.ID,
+				LineIndex: line.index,
+				Line:      line.text,
+				Link:      messageLink(source.ChannelID, m.ID),
+			})
+		}
+	}
+	return nil
+}
+
+// verifyEventUsers compares the users listed below an event with the lines
+// listing them, in order. Users without a line are reported as missing lines,
+// lines without a user as not stored.
+func verifyEventUsers(i database.Interaction, lines []sourceLine, problem verifyProblem, report *verifyReport) {
+	mentions := slices.Clone(i.UserMentions)
+	slices.SortFunc(mentions, func(a, b database.InteractionUserMention) int {
+		return a.ID - b.ID
+	})
+	for n := 0; n < max(len(mentions), len(lines)); n++ {
+		problem := problem
+		if n < len(lines) {
+			problem.LineIndex = lines[n].index
+			problem.Line = lines[n].text
+		}
+		if n < len(mentions) {
+			problem.Rendered = template.RenderUser(mentions[n])
+		}
+		switch {
+		case n >= len(lines):
+			problem.Problem = verifyMissingLine
+		case n >= len(mentions):
+			problem.Problem = verifyNotStored
+		case problem.Rendered != problem.Line:
+			problem.Problem = verifyMismatch
+		default:
+			continue
+		}
+		report.Problems = append(report.Problems, problem)
+	}
+}
@@ -9,6 +9,14 @@ OLDPWD=$(pwd)
 [ -z "$GIT_USER_NAME" ] || git config --global user.name "$GIT_USER_NAME"
 [ -z "$GIT_USER_EMAIL" ] || git config --global user.email "$GIT_USER_EMAIL"
 [ -z "$DISCORD_TOKEN_FILE" ] || DISCORD_TOKEN="$(cat "$DISCORD_TOKEN_FILE")"
+if [ -n "${OPT_OUT_KEY_FILE:-}" ]; then
+    if [ ! -r "$OPT_OUT_KEY_FILE" ]; then
+        echo "ERROR: OPT_OUT_KEY_FILE is set but $OPT_OUT_KEY_FILE can not be read, see docker-compose.yml." >&2
+        exit 1
+    fi
+    OPT_OUT_KEY="$(cat "$OPT_OUT_KEY_FILE")"
+    export OPT_OUT_KEY
+fi
 if [ -n "$SSH_KNOWN_HOSTS_FILE" ]; then
     mkdir -p ~/.ssh
     cat "$SSH_KNOWN_HOSTS_FILE" >~/.ssh/known_hosts
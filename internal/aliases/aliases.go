@@ -0,0 +1,109 @@
+// Package aliases reads the hand-maintained list of user names that the tool
+// could not observe on its own, e.g. because someone changed their name before
+// any export picked up the old one.
+package aliases
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Alias is a name a user is known to have used during a period of time.
+type Alias struct {
+	UserID string    `yaml:"user_id"`
+	Name   string    `yaml:"name"`
+	From   time.Time `yaml:"valid_from"`
+	// Until is the end of the period, if nil the name was used until the
+	// next observed name change.
+	Until *time.Time `yaml:"valid_until,omitempty"`
+	Note  string     `yaml:"note,omitempty"`
+}
+
+func (a Alias) String() string {
+	return fmt.Sprintf("%s/%s", a.UserID, a.Name)
+}
+
+// overlaps returns whether both aliases were valid at the same time.
+func (a Alias) overlaps(b Alias) bool {
+	return (a.Until == nil || b.From.Before(*a.Until)) &&
+		(b.Until == nil || a.From.Before(*b.Until))
+}
+
+// File is the alias file format, it can be written as YAML or JSON.
+type File struct {
+	Aliases []Alias `yaml:"aliases"`
+}
+
+// Load reads and validates the alias file at the given path. A missing file
+// is the same as an empty one.
+func Load(path string) ([]Alias, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Alias{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	aliases, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alias file %s: %w", path, err)
+	}
+	return aliases, nil
+}
+
+// Read parses and validates an alias file.
+func Read(r io.Reader) ([]Alias, error) {
+	var file File
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := Validate(file.Aliases); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(file.Aliases, func(a, b Alias) int {
+		return a.From.Compare(b.From)
+	})
+	return file.Aliases, nil
+}
+
+// Validate checks that every alias is complete and that neither a user had
+// two names nor a name belonged to two users at the same time.
+func Validate(aliases []Alias) error {
+	errs := []error{}
+	for i, a := range aliases {
+		switch {
+		case len(a.UserID) == 0:
+			errs = append(errs, fmt.Errorf("alias #%d: missing user_id", i+1))
+		case len(a.Name) == 0:
+			errs = append(errs, fmt.Errorf("alias #%d: missing name", i+1))
+		case a.From.IsZero():
+			errs = append(errs, fmt.Errorf("alias #%d (%s): missing valid_from", i+1, a))
+		case a.Until != nil && !a.Until.After(a.From):
+			errs = append(errs, fmt.Errorf("alias #%d (%s): valid_until is not after valid_from", i+1, a))
+		}
+		for j, b := range aliases[:i] {
+			if !a.overlaps(b) {
+				continue
+			}
+			switch {
+			case a.UserID == b.UserID && a.Name != b.Name:
+				errs = append(errs, fmt.Errorf("alias #%d (%s) overlaps with alias #%d (%s) of the same user", i+1, a, j+1, b))
+			case a.UserID != b.UserID && a.Name == b.Name:
+				errs = append(errs, fmt.Errorf("alias #%d (%s) overlaps with alias #%d (%s) of the same name", i+1, a, j+1, b))
+			case a.UserID == b.UserID && a.Name == b.Name:
+				errs = append(errs, fmt.Errorf("alias #%d (%s) duplicates alias #%d", i+1, a, j+1))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package aliases
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(d int) time.Time {
+	return time.Date(2024, 4, d, 0, 0, 0, 0, time.UTC)
+}
+
+func until(d int) *time.Time {
+	t := day(d)
+	return &t
+}
+
+func TestValidateOverlaps(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		aliases []Alias
+		// err is part of the expected error, empty if the aliases are valid.
+		err string
+	}{
+		{
+			name: "adjacent names of the same user",
+			aliases: []Alias{
+				{UserID: "1", Name: "old", From: day(1), Until: until(2)},
+				{UserID: "1", Name: "new", From: day(2), Until: until(3)},
+			},
+		},
+		{
+			name: "adjacent users of the same name",
+			aliases: []Alias{
+				{UserID: "1", Name: "name", From: day(1), Until: until(2)},
+				{UserID: "2", Name: "name", From: day(2)},
+			},
+		},
+		{
+			name: "overlapping names of the same user",
+			aliases: []Alias{
+				{UserID: "1", Name: "old", From: day(1), Until: until(3)},
+				{UserID: "1", Name: "new", From: day(2), Until: until(4)},
+			},
+			err: "alias #2 (1/new) overlaps with alias #1 (1/old) of the same user",
+		},
+		{
+			name: "open-ended name followed by another user",
+			aliases: []Alias{
+				{UserID: "1", Name: "name", From: day(1)},
+				{UserID: "2", Name: "name", From: day(5), Until: until(6)},
+			},
+			err: "alias #2 (2/name) overlaps with alias #1 (1/name) of the same name",
+		},
+		{
+			name: "open-ended name preceded by another user",
+			aliases: []Alias{
+				{UserID: "2", Name: "name", From: day(5)},
+				{UserID: "1", Name: "name", From: day(1), Until: until(6)},
+			},
+			err: "alias #2 (1/name) overlaps with alias #1 (2/name) of the same name",
+		},
+		{
+			name: "open-ended names of different users",
+			aliases: []Alias{
+				{UserID: "1", Name: "one", From: day(1)},
+				{UserID: "2", Name: "two", From: day(1)},
+			},
+		},
+		{
+			name: "same user and name twice",
+			aliases: []Alias{
+				{UserID: "1", Name: "name", From: day(1), Until: until(3)},
+				{UserID: "1", Name: "name", From: day(2)},
+			},
+			err: "alias #2 (1/name) duplicates alias #1",
+		},
+		{
+			name: "same user and name adjacent",
+			aliases: []Alias{
+				{UserID: "1", Name: "name", From: day(1), Until: until(2)},
+				{UserID: "1", Name: "name", From: day(2)},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.aliases)
+			switch {
+			case len(test.err) == 0 && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case len(test.err) > 0 && err == nil:
+				t.Errorf("got no error, want %q", test.err)
+			case len(test.err) > 0 && !strings.Contains(err.Error(), test.err):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidateIncomplete(t *testing.T) {
+	err := Validate([]Alias{
+		{Name: "name", From: day(1)},
+		{UserID: "1", From: day(1)},
+		{UserID: "2", Name: "two"},
+		{UserID: "3", Name: "three", From: day(2), Until: until(2)},
+	})
+	if err == nil {
+		t.Fatal("got no error for incomplete aliases")
+	}
+	for _, want := range []string{
+		"alias #1: missing user_id",
+		"alias #2: missing name",
+		"alias #3 (2/two): missing valid_from",
+		"alias #4 (3/three): valid_until is not after valid_from",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want it to contain %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package database
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Dialects the database can be exported as.
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+)
+
+// dialectViews are the views of dialectViewsTemplate in the order they are
+// created in.
+var dialectViews = []string{
+	"user_latest_names",
+	"interaction_details",
+	"player_game_participation",
+	"game_results",
+}
+
+//go:embed dialect_views.sql
+var dialectViewsTemplate string
+
+// insertBatchSize is the amount of rows per INSERT statement.
+const insertBatchSize = 100
+
+// maxKeyBytes is the maximum size of a MySQL key. Strings take up to 4 bytes
+// per character, integers 8 bytes.
+const maxKeyBytes = 3072
+
+// defaultKeyLength is used for string columns that need a length for other
+// reasons than being part of a key.
+const defaultKeyLength = 191
+
+// dialect writes DDL and values for a specific database server.
+type dialect interface {
+	quote(name string) string
+	// dataType returns the column type, keyLength is the maximum length of
+	// strings that are part of a key or zero if the column is not.
+	dataType(field *schema.Field, keyLength int) string
+	autoIncrement() string
+	boolean(v bool) string
+	timestamp(t time.Time) string
+	str(s string) string
+	// resetSequence returns the statement that makes the auto increment
+	// counter continue after the imported rows, if any is needed.
+	resetSequence(table, column string) string
+	// tableOptions is appended to CREATE TABLE.
+	tableOptions() string
+	// dropCascade is appended to DROP TABLE so tables referenced by anything
+	// outside of the dump can be dropped.
+	dropCascade() string
+	// stringAgg concatenates the values of expr in the given order,
+	// separated by ";".
+	stringAgg(expr, order string) string
+	// boolOr is the aggregate that is true if expr is true for any row.
+	boolOr(expr string) string
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (postgresDialect) dataType(field *schema.Field, keyLength int) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "boolean"
+	case schema.Int, schema.Uint:
+		if field.Size > 0 && field.Size <= 32 {
+			return "integer"
+		}
+		return "bigint"
+	case schema.Float:
+		return "double precision"
+	case schema.Time:
+		return "timestamptz"
+	case schema.Bytes:
+		return "bytea"
+	}
+	if field.Size > 0 {
+		return fmt.Sprintf("varchar(%d)", field.Size)
+	}
+	return "text"
+}
+
+func (postgresDialect) autoIncrement() string {
+	return "GENERATED BY DEFAULT AS IDENTITY"
+}
+
+func (postgresDialect) boolean(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (d postgresDialect) timestamp(t time.Time) string {
+	return d.str(t.UTC().Format("2006-01-02 15:04:05.999999")+"+00") + "::timestamptz"
+}
+
+func (postgresDialect) str(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (d postgresDialect) resetSequence(table, column string) string {
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), COALESCE(MAX(%s), 0) + 1, false) FROM %s;",
+		d.str(table), d.str(column), d.quote(column), d.quote(table))
+}
+
+func (postgresDialect) tableOptions() string {
+	return ""
+}
+
+func (postgresDialect) dropCascade() string {
+	return " CASCADE"
+}
+
+func (postgresDialect) stringAgg(expr, order string) string {
+	return fmt.Sprintf("STRING_AGG(%s, ';' ORDER BY %s)", expr, order)
+}
+
+func (postgresDialect) boolOr(expr string) string {
+	return fmt.Sprintf("BOOL_OR(%s)", expr)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (mysqlDialect) dataType(field *schema.Field, keyLength int) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "boolean"
+	case schema.Int, schema.Uint:
+		if field.Size > 0 && field.Size <= 32 {
+			return "int"
+		}
+		return "bigint"
+	case schema.Float:
+		return "double"
+	case schema.Time:
+		return "datetime(6)"
+	case schema.Bytes:
+		return "longblob"
+	}
+	switch {
+	case field.Size > 0:
+		return fmt.Sprintf("varchar(%d)", field.Size)
+	case keyLength > 0:
+		// MySQL can neither index nor default text columns
+		return fmt.Sprintf("varchar(%d)", keyLength)
+	}
+	return "longtext"
+}
+
+func (mysqlDialect) autoIncrement() string {
+	return "AUTO_INCREMENT"
+}
+
+func (mysqlDialect) boolean(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (d mysqlDialect) timestamp(t time.Time) string {
+	// datetime has no time zone, everything is stored in UTC
+	return d.str(t.UTC().Format("2006-01-02 15:04:05.999999"))
+}
+
+func (mysqlDialect) str(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''", "\x00", `\0`).Replace(s) + "'"
+}
+
+func (mysqlDialect) tableOptions() string {
+	return " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+}
+
+func (mysqlDialect) dropCascade() string {
+	// MySQL parses CASCADE but ignores it, see the foreign key checks instead
+	return ""
+}
+
+func (mysqlDialect) resetSequence(table, column string) string {
+	// AUTO_INCREMENT continues after the highest inserted value by itself
+	return ""
+}
+
+func (mysqlDialect) stringAgg(expr, order string) string {
+	return fmt.Sprintf("GROUP_CONCAT(%s ORDER BY %s SEPARATOR ';')", expr, order)
+}
+
+func (mysqlDialect) boolOr(expr string) string {
+	// booleans are integers
+	return fmt.Sprintf("MAX(%s)", expr)
+}
+
+// exportTables returns the schemas of all tables in the order they need to be
+// created in, which includes the join tables of many2many relationships.
+func (d *Database) exportTables() ([]*schema.Schema, error) {
+	tables := []*schema.Schema{}
+	for _, entity := range append([]any{&SchemaMigration{}}, entities...) {
+		stmt := &gorm.Statement{DB: d.db}
+		if err := stmt.Parse(entity); err != nil {
+			return nil, err
+		}
+		tables = append(tables, stmt.Schema)
+	}
+	// join tables reference both sides, so they go last
+	for _, table := range slices.Clone(tables) {
+		for _, rel := range table.Relationships.Many2Many {
+			tables = append(tables, rel.JoinTable)
+		}
+	}
+	return tables, nil
+}
+
+// ExportDialect writes an SQL dump that loads into an empty database of the
+// given dialect. Foreign keys are added after all data has been inserted.
+func (d *Database) ExportDialect(out io.Writer, dialectName string) error {
+	var dia dialect
+	switch dialectName {
+	case DialectPostgres:
+		dia = postgresDialect{}
+	case DialectMySQL:
+		dia = mysqlDialect{}
+	default:
+		return fmt.Errorf("unsupported dialect: %s", dialectName)
+	}
+
+	tables, err := d.exportTables()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(out)
+	if dialectName == DialectMySQL {
+		fmt.Fprintln(w, "SET NAMES utf8mb4;")
+		fmt.Fprintln(w, "SET time_zone = '+00:00';")
+		fmt.Fprintln(w, "SET FOREIGN_KEY_CHECKS = 0;")
+	}
+	fmt.Fprintln(w, "BEGIN;")
+
+	// drop in reverse so nothing references a dropped table
+	for i := len(dialectViews) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "DROP VIEW IF EXISTS %s%s;\n", dia.quote(dialectViews[i]), dia.dropCascade())
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "DROP TABLE IF EXISTS %s%s;\n", dia.quote(tables[i].Table), dia.dropCascade())
+	}
+
+	for _, table := range tables {
+		if err := writeCreateTable(w, dia, table); err != nil {
+			return err
+		}
+		if err := d.writeRows(w, dia, table); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range tables {
+		for _, rel := range table.Relationships.Relations {
+			constraint := rel.ParseConstraint()
+			if constraint == nil || constraint.Schema != table {
+				continue
+			}
+			foreignKeys := []string{}
+			for _, field := range constraint.ForeignKeys {
+				foreignKeys = append(foreignKeys, dia.quote(field.DBName))
+			}
+			references := []string{}
+			for _, field := range constraint.References {
+				references = append(references, dia.quote(field.DBName))
+			}
+			fmt.Fprintf(w, "ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s);\n",
+				dia.quote(table.Table), dia.quote(constraint.Name),
+				strings.Join(foreignKeys, ","),
+				dia.quote(constraint.ReferenceSchema.Table), strings.Join(references, ","))
+		}
+	}
+
+	if err := writeViews(w, dia); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "COMMIT;")
+	if dialectName == DialectMySQL {
+		fmt.Fprintln(w, "SET FOREIGN_KEY_CHECKS = 1;")
+	}
+	return w.Flush()
+}
+
+// writeViews writes the views, which the dialects do not share the SQLite
+// syntax of.
+func writeViews(w io.Writer, dia dialect) error {
+	views, err := template.New("views").Funcs(template.FuncMap{
+		"quote":     dia.quote,
+		"stringAgg": dia.stringAgg,
+		"boolOr":    dia.boolOr,
+	}).Parse(dialectViewsTemplate)
+	if err != nil {
+		return err
+	}
+	return views.Execute(w, nil)
+}
+
+// exportFields returns the fields of a table that are stored in a column.
+func exportFields(table *schema.Schema) []*schema.Field {
+	fields := []*schema.Field{}
+	for _, field := range table.Fields {
+		if len(field.DBName) > 0 {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func writeCreateTable(w io.Writer, dia dialect, table *schema.Schema) error {
+	indexes := table.ParseIndexes()
+	keys := [][]string{}
+	for _, index := range indexes {
+		key := []string{}
+		for _, option := range index.Fields {
+			key = append(key, option.DBName)
+		}
+		keys = append(keys, key)
+	}
+	for _, rel := range table.Relationships.Relations {
+		for _, ref := range rel.References {
+			if ref.ForeignKey != nil && ref.ForeignKey.Schema == table {
+				keys = append(keys, []string{ref.ForeignKey.DBName})
+			}
+		}
+	}
+	primaryKey := []string{}
+	for _, field := range table.PrimaryFields {
+		primaryKey = append(primaryKey, field.DBName)
+	}
+	keys = append(keys, primaryKey)
+
+	// string columns of a key share its maximum length
+	keyLengths := map[string]int{}
+	for _, key := range keys {
+		strs := slices.DeleteFunc(slices.Clone(key), func(name string) bool {
+			return table.FieldsByDBName[name].DataType != schema.String
+		})
+		for _, name := range strs {
+			length := (maxKeyBytes - 8*(len(key)-len(strs))) / 4 / len(strs)
+			if l, ok := keyLengths[name]; !ok || length < l {
+				keyLengths[name] = length
+			}
+		}
+	}
+	for _, field := range table.Fields {
+		if _, ok := keyLengths[field.DBName]; !ok && field.HasDefaultValue && len(field.DBName) > 0 {
+			keyLengths[field.DBName] = defaultKeyLength
+		}
+	}
+
+	columns := []string{}
+	primaryKeys := []string{}
+	for _, field := range exportFields(table) {
+		column := dia.quote(field.DBName) + " " + dia.dataType(field, keyLengths[field.DBName])
+		switch {
+		case field.AutoIncrement:
+			column += " " + dia.autoIncrement()
+		case field.HasDefaultValue && field.DefaultValueInterface != nil:
+			column += " DEFAULT " + literal(dia, field, field.DefaultValueInterface)
+		case field.HasDefaultValue && len(field.DefaultValue) > 0:
+			column += " DEFAULT " + literal(dia, field, strings.Trim(field.DefaultValue, `"'`))
+		}
+		if field.NotNull || field.PrimaryKey {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+		if field.PrimaryKey {
+			primaryKeys = append(primaryKeys, dia.quote(field.DBName))
+		}
+	}
+	if len(primaryKeys) > 0 {
+		columns = append(columns, "PRIMARY KEY ("+strings.Join(primaryKeys, ",")+")")
+	}
+	if _, err := fmt.Fprintf(w, "CREATE TABLE %s (\n  %s\n)%s;\n", dia.quote(table.Table), strings.Join(columns, ",\n  "), dia.tableOptions()); err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := indexes[name]
+		fields := []string{}
+		for _, option := range index.Fields {
+			fields = append(fields, dia.quote(option.DBName))
+		}
+		class := ""
+		if index.Class == "UNIQUE" {
+			class = "UNIQUE "
+		}
+		if _, err := fmt.Fprintf(w, "CREATE %sINDEX %s ON %s (%s);\n", class, dia.quote(index.Name), dia.quote(table.Table), strings.Join(fields, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// literal formats a value read from SQLite as an SQL literal for the column.
+func literal(dia dialect, field *schema.Field, value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return dia.boolean(v)
+	case int64:
+		if field.DataType == schema.Bool {
+			return dia.boolean(v != 0)
+		}
+		return fmt.Sprint(v)
+	case float64:
+		if field.DataType == schema.Bool {
+			return dia.boolean(v != 0)
+		}
+		return fmt.Sprint(v)
+	case time.Time:
+		return dia.timestamp(v)
+	case []byte:
+		return dia.str(string(v))
+	case string:
+		if field.DataType == schema.Time {
+			if t, ok := parseTime(v); ok {
+				return dia.timestamp(t)
+			}
+		}
+		return dia.str(v)
+	}
+	return dia.str(fmt.Sprint(value))
+}
+
+func (d *Database) writeRows(w io.Writer, dia dialect, table *schema.Schema) error {
+	fields := exportFields(table)
+	columns := []string{}
+	quotedColumns := []string{}
+	for _, field := range fields {
+		columns = append(columns, fmt.Sprintf("%q", field.DBName))
+		quotedColumns = append(quotedColumns, dia.quote(field.DBName))
+	}
+	orderBy := []string{}
+	for _, field := range table.PrimaryFields {
+		orderBy = append(orderBy, fmt.Sprintf("%q", field.DBName))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %q", strings.Join(columns, ","), table.Table)
+	if len(orderBy) > 0 {
+		query += " ORDER BY " + strings.Join(orderBy, ",")
+	}
+	rows, err := d.db.Raw(query).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", dia.quote(table.Table), strings.Join(quotedColumns, ","))
+	batch := []string{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "%s%s;\n", insert, strings.Join(batch, ",\n"))
+		batch = batch[:0]
+		return err
+	}
+	values := make([]any, len(fields))
+	pointers := make([]any, len(fields))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		literals := make([]string, len(fields))
+		for i, field := range fields {
+			literals[i] = literal(dia, field, values[i])
+		}
+		batch = append(batch, "("+strings.Join(literals, ",")+")")
+		if len(batch) >= insertBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if !field.AutoIncrement {
+			continue
+		}
+		if stmt := dia.resetSequence(table.Table, field.DBName); len(stmt) > 0 {
+			if _, err := fmt.Fprintln(w, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDialectTestDB returns an in-memory database with a finished game of a
+// single round.
+func newDialectTestDB(t *testing.T) *Database {
+	t.Helper()
+	// every connection to a plain :memory: database gets an empty one
+	db, err := OpenSQLite("file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// the models are enough, migrations need the FTS5 build tag
+	if err := db.db.AutoMigrate(append([]any{&SchemaMigration{}}, entities...)...); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 4, 1, 10, 5, 0, 0, time.UTC)
+	end := start.Add(3*time.Minute + 500*time.Millisecond)
+	host := "111"
+	game := Game{
+		ID:                 1,
+		DiscordChannelID:   "1224009923457847428",
+		DiscordMessageID:   "1004",
+		Era:                "Classic",
+		HostUserID:         &host,
+		HostUserName:       &host,
+		StartTime:          &start,
+		EndTime:            &end,
+		Cancelled:          true,
+		CountdownStartTime: start.Add(-2 * time.Minute),
+		RewardCoins:        6000,
+	}
+	for _, row := range []any{
+		&User{ID: host},
+		&game,
+		&Round{ID: 1, GameID: game.ID, RoundNumber: 0, PostTime: start, DiscordMessageID: "1005"},
+	} {
+		if err := db.db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func exportDialect(t *testing.T, db *Database, dialect string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := db.ExportDialect(&buf, dialect); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// assertContains checks that every want appears in the dump, in order.
+func assertContains(t *testing.T, dump string, wants ...string) {
+	t.Helper()
+	rest := dump
+	for _, want := range wants {
+		i := strings.Index(rest, want)
+		if i < 0 {
+			if strings.Contains(dump, want) {
+				t.Errorf("dump contains %q, but out of order", want)
+			} else {
+				t.Errorf("dump does not contain %q", want)
+			}
+			continue
+		}
+		rest = rest[i+len(want):]
+	}
+}
+
+func TestExportDialectPostgres(t *testing.T) {
+	dump := exportDialect(t, newDialectTestDB(t), DialectPostgres)
+
+	assertContains(t, dump,
+		"BEGIN;\n",
+		`DROP VIEW IF EXISTS "game_results" CASCADE;`,
+		`DROP TABLE IF EXISTS "rounds" CASCADE;`,
+		`DROP TABLE IF EXISTS "games" CASCADE;`,
+		`CREATE UNIQUE INDEX "import_source_idx" ON "import_sources" ("path","checksum");`,
+		"CREATE TABLE \"users\" (\n  \"id\" text NOT NULL,",
+		`"kind" text DEFAULT 'username',`,
+		"CREATE TABLE \"games\" (\n  \"id\" bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL,",
+		`"start_time" timestamptz,`,
+		`"xp_multiplier" double precision,`,
+		`"host_user_ambiguous" boolean,`,
+		`INSERT INTO "games" (`,
+		`'1004','Classic','111','111','2024-04-01 10:05:00+00'::timestamptz,'2024-04-01 10:08:00.5+00'::timestamptz,TRUE,`,
+		`SELECT setval(pg_get_serial_sequence('games', 'id'), COALESCE(MAX("id"), 0) + 1, false) FROM "games";`,
+		`CREATE UNIQUE INDEX "game_round_idx" ON "rounds" ("game_id","round_number");`,
+		`INSERT INTO "rounds" (`,
+		`ALTER TABLE "rounds" ADD CONSTRAINT "fk_rounds_game" FOREIGN KEY ("game_id") REFERENCES "games" ("id");`,
+		// views come last as they refer to tables and each other
+		`CREATE VIEW "user_latest_names" AS`,
+		`CREATE VIEW "interaction_details" AS`,
+		`STRING_AGG(COALESCE(uln.name, um.user_name), ';' ORDER BY um.id)`,
+		`CREATE VIEW "player_game_participation" AS`,
+		`BOOL_OR(g.winner_user_id IS NOT NULL AND g.winner_user_id = pa.user_id) AS won`,
+		`CREATE VIEW "game_results" AS`,
+		"COMMIT;\n",
+	)
+	if strings.Contains(dump, "FOREIGN_KEY_CHECKS") || strings.Contains(dump, "ENGINE=") {
+		t.Error("postgres dump contains MySQL statements")
+	}
+	// constraints are only added once all rows are in
+	if strings.LastIndex(dump, "INSERT INTO") > strings.Index(dump, "ALTER TABLE") {
+		t.Error("constraint added before all rows are inserted")
+	}
+}
+
+func TestExportDialectMySQL(t *testing.T) {
+	dump := exportDialect(t, newDialectTestDB(t), DialectMySQL)
+
+	assertContains(t, dump,
+		"SET NAMES utf8mb4;\nSET time_zone = '+00:00';\nSET FOREIGN_KEY_CHECKS = 0;\nBEGIN;\n",
+		"DROP VIEW IF EXISTS `game_results`;",
+		"DROP TABLE IF EXISTS `rounds`;",
+		// strings of a key share its length
+		"`path` varchar(384),\n  `checksum` varchar(384),",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+		// a single string primary key gets the whole key length
+		"CREATE TABLE `users` (\n  `id` varchar(768) NOT NULL,",
+		// MySQL can not default text columns
+		"`kind` varchar(191) DEFAULT 'username',",
+		"CREATE TABLE `games` (\n  `id` bigint AUTO_INCREMENT NOT NULL,",
+		"`discord_channel_id` longtext,",
+		"`start_time` datetime(6),",
+		"INSERT INTO `games` (",
+		"'1004','Classic','111','111','2024-04-01 10:05:00','2024-04-01 10:08:00.5',TRUE,",
+		"ALTER TABLE `rounds` ADD CONSTRAINT `fk_rounds_game` FOREIGN KEY (`game_id`) REFERENCES `games` (`id`);",
+		"CREATE VIEW `interaction_details` AS",
+		"GROUP_CONCAT(COALESCE(uln.name, um.user_name) ORDER BY um.id SEPARATOR ';')",
+		"CREATE VIEW `game_results` AS",
+		"COMMIT;\nSET FOREIGN_KEY_CHECKS = 1;\n",
+	)
+	// AUTO_INCREMENT continues after the inserted rows by itself
+	if strings.Contains(dump, "setval") {
+		t.Error("mysql dump resets sequences")
+	}
+	if strings.Contains(dump, " CASCADE") {
+		t.Error("mysql dump drops tables with CASCADE")
+	}
+}
+
+func TestExportDialectUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newDialectTestDB(t).ExportDialect(&buf, "oracle"); err == nil {
+		t.Error("exported unknown dialect")
+	}
+}
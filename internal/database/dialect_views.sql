@@ -0,0 +1,126 @@
+{{- /*
+The views of migrations/0002_views.up.sql for the other dialects, as a
+text/template with the quote, stringAgg and boolOr functions of the dialect.
+Keep both in sync.
+*/ -}}
+
+CREATE VIEW {{quote "user_latest_names"}} AS
+SELECT
+    u.id AS user_id,
+    u.player_id AS player_id,
+    (
+        SELECT uno.name
+        FROM user_name_observations uno
+        WHERE uno.user_id = u.id AND uno.kind = 'username'
+        ORDER BY uno.time DESC, uno.id DESC
+        LIMIT 1
+    ) AS name,
+    (
+        SELECT uno.name
+        FROM user_name_observations uno
+        WHERE uno.user_id = u.id AND uno.kind != 'username'
+        ORDER BY uno.time DESC, uno.id DESC
+        LIMIT 1
+    ) AS display_name
+FROM users u;
+
+CREATE VIEW {{quote "interaction_details"}} AS
+SELECT
+    i.id AS interaction_id,
+    r.game_id AS game_id,
+    i.round_id AS round_id,
+    r.round_number AS round_number,
+    r.post_time AS post_time,
+    m.event AS event,
+    m.text AS text,
+    (
+        SELECT {{stringAgg "im.item_name" "im.item_name"}}
+        FROM interaction_item_mappings im
+        WHERE im.interaction_id = i.id
+    ) AS items,
+    (
+        SELECT {{stringAgg "COALESCE(uln.name, um.user_name)" "um.id"}}
+        FROM interaction_user_mention_mappings umm
+        JOIN interaction_user_mentions um
+            ON umm.interaction_user_mention_id = um.id
+        LEFT JOIN user_latest_names uln
+            ON um.user_id = uln.user_id
+        WHERE umm.interaction_id = i.id
+    ) AS users,
+    (
+        SELECT {{stringAgg "COALESCE(uln.name, um.user_name)" "um.id"}}
+        FROM interaction_user_mention_mappings umm
+        JOIN interaction_user_mentions um
+            ON umm.interaction_user_mention_id = um.id
+        LEFT JOIN user_latest_names uln
+            ON um.user_id = uln.user_id
+        WHERE umm.interaction_id = i.id AND um.killed
+    ) AS killed_users,
+    i.source_message_id AS source_message_id,
+    i.source_line_index AS source_line_index
+FROM interactions i
+JOIN rounds r
+    ON i.round_id = r.id
+LEFT JOIN interaction_messages m
+    ON i.message_id = m.id;
+
+CREATE VIEW {{quote "player_game_participation"}} AS
+WITH participations AS (
+    SELECT r.game_id, um.user_id
+    FROM interactions i
+    JOIN rounds r
+        ON i.round_id = r.id
+    JOIN interaction_user_mention_mappings umm
+        ON i.id = umm.interaction_id
+    JOIN interaction_user_mentions um
+        ON umm.interaction_user_mention_id = um.id
+    WHERE um.user_id IS NOT NULL
+    UNION
+    SELECT g.id, g.winner_user_id
+    FROM games g
+    WHERE g.winner_user_id IS NOT NULL
+)
+SELECT
+    u.player_id AS player_id,
+    COALESCE(p.name, (
+        SELECT uln.name
+        FROM user_latest_names uln
+        WHERE uln.player_id = u.player_id
+        ORDER BY uln.user_id
+        LIMIT 1
+    )) AS player_name,
+    pa.game_id AS game_id,
+    {{boolOr "g.winner_user_id IS NOT NULL AND g.winner_user_id = pa.user_id"}} AS won
+FROM participations pa
+JOIN users u
+    ON pa.user_id = u.id
+JOIN games g
+    ON pa.game_id = g.id
+LEFT JOIN players p
+    ON u.player_id = p.id
+GROUP BY u.player_id, p.name, pa.game_id;
+
+CREATE VIEW {{quote "game_results"}} AS
+SELECT
+    g.id AS game_id,
+    g.discord_channel_id AS discord_channel_id,
+    g.discord_message_id AS discord_message_id,
+    g.era AS era,
+    g.countdown_start_time AS countdown_start_time,
+    g.start_time AS start_time,
+    g.end_time AS end_time,
+    g.cancelled AS cancelled,
+    g.host_user_id AS host_user_id,
+    COALESCE(host.name, g.host_user_name) AS host_name,
+    g.winner_user_id AS winner_user_id,
+    winner.player_id AS winner_player_id,
+    COALESCE(winner.name, g.winner_user_name) AS winner_name,
+    (SELECT COUNT(*) FROM rounds r WHERE r.game_id = g.id) AS rounds,
+    (SELECT COUNT(*) FROM player_game_participation pgp WHERE pgp.game_id = g.id) AS players,
+    g.xp_multiplier AS xp_multiplier,
+    g.reward_coins AS reward_coins
+FROM games g
+LEFT JOIN user_latest_names host
+    ON g.host_user_id = host.user_id
+LEFT JOIN user_latest_names winner
+    ON g.winner_user_id = winner.user_id;
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SchemaDumpPart is the name of the dump part creating all tables, indexes and
+// views. Every table's rows are in a part named after the table.
+const SchemaDumpPart = "schema"
+
+type sqliteObject struct {
+	Type string
+	Name string
+	SQL  string
+	// TableType tells virtual and shadow tables, such as those of full-text
+	// indexes, apart from ordinary ones.
+	TableType string
+}
+
+// sqliteObjectsQuery selects all objects with their SQL except for SQLite's
+// own and the shadow tables backing virtual tables, which are created along
+// with them.
+const sqliteObjectsQuery = `SELECT m.type, m.name, m.sql, COALESCE(tl.type, '') AS table_type
+	FROM sqlite_master m
+	LEFT JOIN pragma_table_list tl ON tl.schema = 'main' AND tl.name = m.name
+	WHERE m.sql IS NOT NULL AND m.name NOT LIKE 'sqlite_%' AND COALESCE(tl.type, '') != 'shadow'`
+
+type sqliteColumn struct {
+	Name string
+	PK   int
+}
+
+// ExportSorted writes a dump that only changes where the data does. Tables,
+// indexes and views are created in the order the migrations created them, rows
+// are ordered by primary key with one INSERT per row. The dump is written in
+// parts, the schema first and then one part per table, each to the writer
+// returned by open. It returns the names of all parts in the order they need
+// to be loaded in.
+//
+// When migrations were applied is left out since it differs between otherwise
+// identical databases. Virtual tables get no part of their own, the full-text
+// indexes are filled by their triggers while the indexed tables are loaded.
+func (d *Database) ExportSorted(open func(part string) (io.WriteCloser, error)) ([]string, error) {
+	var objects []sqliteObject
+	if tx := d.db.Raw(sqliteObjectsQuery + " ORDER BY m.rowid").Scan(&objects); tx.Error != nil {
+		return nil, tx.Error
+	}
+	tables := []string{}
+	for _, object := range objects {
+		if object.Type == "table" && object.TableType != "virtual" {
+			tables = append(tables, object.Name)
+		}
+	}
+
+	w, err := open(SchemaDumpPart)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+	for i := len(objects) - 1; i >= 0; i-- {
+		switch objects[i].Type {
+		case "table", "view":
+			fmt.Fprintf(w, "DROP %s IF EXISTS %q;\n", strings.ToUpper(objects[i].Type), objects[i].Name)
+		}
+	}
+	for _, object := range objects {
+		fmt.Fprintf(w, "%s;\n", object.SQL)
+	}
+	fmt.Fprintln(w, "COMMIT;")
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	parts := []string{SchemaDumpPart}
+	for _, table := range tables {
+		w, err := open(table)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.writeSortedRows(w, table); err != nil {
+			w.Close()
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		parts = append(parts, table)
+	}
+	return parts, nil
+}
+
+func (d *Database) writeSortedRows(w io.Writer, table string) error {
+	var columns []sqliteColumn
+	if tx := d.db.Raw(fmt.Sprintf("SELECT name, pk FROM pragma_table_info(%s) ORDER BY cid", quoteLiteral(table))).Scan(&columns); tx.Error != nil {
+		return tx.Error
+	}
+	names := []string{}
+	values := []string{}
+	primaryKey := map[int]string{}
+	for _, column := range columns {
+		names = append(names, fmt.Sprintf("%q", column.Name))
+		value := fmt.Sprintf("quote(%q)", column.Name)
+		if table == "schema_migrations" && column.Name == "applied_at" {
+			value = "'NULL'"
+		}
+		values = append(values, value)
+		if column.PK > 0 {
+			primaryKey[column.PK] = fmt.Sprintf("%q", column.Name)
+		}
+	}
+	orderBy := []string{}
+	for i := 1; i <= len(primaryKey); i++ {
+		orderBy = append(orderBy, primaryKey[i])
+	}
+	if len(orderBy) == 0 {
+		orderBy = names
+	}
+
+	rows, err := d.db.Raw(fmt.Sprintf("SELECT %s FROM %q ORDER BY %s",
+		strings.Join(values, " || ',' || "), table, strings.Join(orderBy, ","))).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if _, err := fmt.Fprintln(w, "BEGIN TRANSACTION;"); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf("INSERT INTO %q (%s) VALUES", table, strings.Join(names, ","))
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s (%s);\n", insert, row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, "COMMIT;")
+	return err
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Empty returns whether the database has no tables yet.
+func (d *Database) Empty() (bool, error) {
+	var count int64
+	if tx := d.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'").Scan(&count); tx.Error != nil {
+		return false, tx.Error
+	}
+	return count == 0, nil
+}
+
+// Load runs an SQL script such as a dump.
+func (d *Database) Load(script string) error {
+	db, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(script)
+	return err
+}
+
+// RowCounts returns the amount of rows in every table.
+func (d *Database) RowCounts() (map[string]int64, error) {
+	relations, err := d.Relations(false)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for _, relation := range relations {
+		var count int64
+		if tx := d.db.Table(relation.Name).Count(&count); tx.Error != nil {
+			return nil, tx.Error
+		}
+		counts[relation.Name] = count
+	}
+	return counts, nil
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the numbered schema migrations, each as an up and a
+// down SQL script named like 0001_initial.up.sql and 0001_initial.down.sql.
+// Applied migrations must never be changed, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// laterEntities were introduced by migrations after the initial one, which
+// create their tables.
+var laterEntities = []any{
+	&TemplateSlot{},
+}
+
+var rxMigrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// SchemaMigration records a migration that was applied to the database.
+type SchemaMigration struct {
+	Version int `gorm:"primaryKey;autoIncrement:false"`
+	Name    string
+	// AppliedAt is unknown for databases loaded from a sorted dump.
+	AppliedAt *time.Time
+}
+
+// Migration is a numbered change to the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is a migration along with whether and when it was applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrations returns all known migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		m := rxMigrationFile.FindStringSubmatch(file.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", file.Name())
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		script, err := migrationFiles.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.up = string(script)
+		} else {
+			migration.down = string(script)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if len(migration.up) == 0 || len(migration.down) == 0 {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the version of the newest known migration.
+func LatestSchemaVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// adoptLegacySchema records the initial migration as applied for databases
+// that were created by AutoMigrate before migrations were versioned. They are
+// migrated once more the old way, since they might be older than the initial
+// migration.
+func (d *Database) adoptLegacySchema() error {
+	migrator := d.db.Migrator()
+	if migrator.HasTable(&SchemaMigration{}) {
+		return nil
+	}
+	if err := migrator.CreateTable(&SchemaMigration{}); err != nil {
+		return err
+	}
+	if !migrator.HasTable(&User{}) {
+		return nil
+	}
+	if err := d.db.AutoMigrate(slices.DeleteFunc(slices.Clone(entities), func(entity any) bool {
+		return slices.ContainsFunc(laterEntities, func(e any) bool {
+			return reflect.TypeOf(e) == reflect.TypeOf(entity)
+		})
+	})...); err != nil {
+		return err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return d.db.Create(&SchemaMigration{
+		Version:   migrations[0].Version,
+		Name:      migrations[0].Name,
+		AppliedAt: &now,
+	}).Error
+}
+
+// SchemaVersion returns the version of the latest migration applied to the
+// database, zero if none.
+func (d *Database) SchemaVersion() (int, error) {
+	if !d.db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version *int
+	if tx := d.db.Model(&SchemaMigration{}).Select("MAX(version)").Scan(&version); tx.Error != nil {
+		return 0, tx.Error
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
+
+// MigrationStatus returns every known migration and whether it was applied.
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied := []SchemaMigration{}
+	if d.db.Migrator().HasTable(&SchemaMigration{}) {
+		if tx := d.db.Find(&applied); tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+	appliedAt := map[int]*time.Time{}
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt
+	}
+	status := []MigrationStatus{}
+	for _, migration := range migrations {
+		s := MigrationStatus{Migration: migration}
+		s.AppliedAt, s.Applied = appliedAt[migration.Version]
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Migrate applies all migrations that were not applied yet.
+func (d *Database) Migrate() error {
+	version, err := LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	return d.MigrateUp(version)
+}
+
+// MigrateUp applies migrations in order until the database is at the given
+// version.
+func (d *Database) MigrateUp(target int) error {
+	if err := d.adoptLegacySchema(); err != nil {
+		return err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if target > len(migrations) {
+		return fmt.Errorf("unknown schema version %d, latest is %d", target, len(migrations))
+	}
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this tool knows about", version)
+	}
+	if version >= target {
+		return nil
+	}
+	for _, migration := range migrations[version:target] {
+		if err := d.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.up).Error; err != nil {
+				if strings.Contains(err.Error(), "no such module: fts5") {
+					return fmt.Errorf("migration %d (%s): %w (build with -tags sqlite_fts5)", migration.Version, migration.Name, err)
+				}
+				return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+			now := time.Now()
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: &now,
+			}).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts migrations in reverse order until the database is at the
+// given version.
+func (d *Database) MigrateDown(target int) error {
+	if err := d.adoptLegacySchema(); err != nil {
+		return err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if target < 0 {
+		return fmt.Errorf("invalid schema version %d", target)
+	}
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this tool knows about", version)
+	}
+	for i := version; i > target; i-- {
+		migration := migrations[i-1]
+		if err := d.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.down).Error; err != nil {
+				return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
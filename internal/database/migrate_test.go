@@ -0,0 +1,144 @@
+//go:build sqlite_fts5
+
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newMigrateTestDB(t *testing.T, name string) *Database {
+	t.Helper()
+	db, err := OpenSQLite("file:" + name + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// columns describes the columns of a table in order, including their type,
+// default and whether they are part of the primary key.
+func columns(t *testing.T, db *Database, table string) []string {
+	t.Helper()
+	rows, err := db.db.Raw("SELECT name, type, dflt_value, pk FROM pragma_table_info(?) ORDER BY cid", table).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns := []string{}
+	for rows.Next() {
+		var name, dataType string
+		var defaultValue *string
+		var pk int
+		if err := rows.Scan(&name, &dataType, &defaultValue, &pk); err != nil {
+			t.Fatal(err)
+		}
+		column := fmt.Sprintf("%s %s", name, dataType)
+		if defaultValue != nil {
+			// AutoMigrate quotes string defaults like identifiers, which
+			// SQLite takes as strings all the same
+			column += " DEFAULT " + strings.ReplaceAll(*defaultValue, `"`, "'")
+		}
+		if pk > 0 {
+			column += fmt.Sprintf(" PRIMARY KEY %d", pk)
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return columns
+}
+
+// objects lists the tables, views, indexes and triggers of a database.
+func objects(t *testing.T, db *Database) []string {
+	t.Helper()
+	objects := []string{}
+	if err := db.db.Raw("SELECT type || ' ' || name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' ORDER BY type, name").Scan(&objects).Error; err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := newMigrateTestDB(t, t.Name())
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := db.SchemaVersion(); err != nil {
+		t.Fatal(err)
+	} else if version != latest {
+		t.Errorf("schema version is %d after migrating, want %d", version, latest)
+	}
+
+	// every column of every model must exist, in order, including the ones
+	// like InteractionUserMention.SlotIndex that are tagged -:migration and
+	// only added by a later migration
+	tables, err := db.exportTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		want := []string{}
+		for _, field := range exportFields(table) {
+			want = append(want, field.DBName)
+		}
+		got := []string{}
+		for _, column := range columns(t, db, table.Table) {
+			got = append(got, strings.Fields(column)[0])
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("columns of %s are %v, want %v", table.Table, got, want)
+		}
+	}
+
+	if err := db.MigrateDown(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := objects(t, db); !slices.Equal(got, []string{"table schema_migrations"}) {
+		t.Errorf("objects left after migrating down: %v", got)
+	}
+}
+
+// TestInitialMigrationMatchesAutoMigrate checks that the initial migration
+// creates the schema as AutoMigrate did before migrations were versioned,
+// which adoptLegacySchema relies on.
+func TestInitialMigrationMatchesAutoMigrate(t *testing.T) {
+	migrated := newMigrateTestDB(t, t.Name()+"-migrated")
+	if err := migrated.MigrateUp(1); err != nil {
+		t.Fatal(err)
+	}
+	legacy := newMigrateTestDB(t, t.Name()+"-legacy")
+	if err := legacy.db.AutoMigrate(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	// adopting runs AutoMigrate on all models the initial migration covers
+	if err := legacy.adoptLegacySchema(); err != nil {
+		t.Fatal(err)
+	}
+
+	gotObjects, wantObjects := objects(t, migrated), objects(t, legacy)
+	if !slices.Equal(gotObjects, wantObjects) {
+		t.Fatalf("initial migration creates %v, AutoMigrate %v", gotObjects, wantObjects)
+	}
+	tables, err := migrated.exportTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if !slices.Contains(gotObjects, "table "+table.Table) {
+			continue
+		}
+		got, want := columns(t, migrated, table.Table), columns(t, legacy, table.Table)
+		if !slices.Equal(got, want) {
+			t.Errorf("columns of %s are %v, AutoMigrate creates %v", table.Table, got, want)
+		}
+	}
+}
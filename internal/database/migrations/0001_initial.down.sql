@@ -0,0 +1,14 @@
+DROP TABLE `interaction_user_mention_mappings`;
+DROP TABLE `interaction_item_mappings`;
+DROP TABLE `interactions`;
+DROP TABLE `interaction_user_mentions`;
+DROP TABLE `rounds`;
+DROP TABLE `games`;
+DROP TABLE `interaction_messages`;
+DROP TABLE `items`;
+DROP TABLE `user_avatar_observations`;
+DROP TABLE `user_role_observations`;
+DROP TABLE `user_name_observations`;
+DROP TABLE `users`;
+DROP TABLE `players`;
+DROP TABLE `import_sources`;
@@ -0,0 +1,20 @@
+-- Schema as created by the AutoMigrate based versions of this tool.
+
+CREATE TABLE `import_sources` (`id` integer PRIMARY KEY AUTOINCREMENT,`path` text,`checksum` text,`exported_at` datetime,`channel_id` text);
+CREATE UNIQUE INDEX `import_source_idx` ON `import_sources`(`path`,`checksum`);
+CREATE TABLE `players` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text);
+CREATE UNIQUE INDEX `idx_players_name` ON `players`(`name`);
+CREATE TABLE `users` (`id` text,`player_id` integer,PRIMARY KEY (`id`),CONSTRAINT `fk_users_player` FOREIGN KEY (`player_id`) REFERENCES `players`(`id`));
+CREATE TABLE `user_name_observations` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` text,`time` datetime,`name` text,`kind` text DEFAULT 'username',`source` text DEFAULT 'message',`valid_until` datetime,`note` text,`source_import_id` integer,`source_message_id` text,CONSTRAINT `fk_user_name_observations_source_import` FOREIGN KEY (`source_import_id`) REFERENCES `import_sources`(`id`),CONSTRAINT `fk_user_name_observations_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+CREATE TABLE `user_role_observations` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` text,`time` datetime,`role_id` text,`role_name` text,`role_color` text,`role_position` integer,`source_import_id` integer,`source_message_id` text,CONSTRAINT `fk_user_role_observations_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_user_role_observations_source_import` FOREIGN KEY (`source_import_id`) REFERENCES `import_sources`(`id`));
+CREATE TABLE `user_avatar_observations` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` text,`time` datetime,`avatar_url` text,`source_import_id` integer,`source_message_id` text,CONSTRAINT `fk_user_avatar_observations_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_user_avatar_observations_source_import` FOREIGN KEY (`source_import_id`) REFERENCES `import_sources`(`id`));
+CREATE TABLE `items` (`name` text,PRIMARY KEY (`name`));
+CREATE TABLE `interaction_messages` (`id` integer PRIMARY KEY AUTOINCREMENT,`text` text,`event` text);
+CREATE UNIQUE INDEX `interaction_message_text_idx` ON `interaction_messages`(`text`);
+CREATE TABLE `games` (`id` integer PRIMARY KEY AUTOINCREMENT,`discord_channel_id` text,`discord_message_id` text,`era` text,`host_user_id` text,`host_user_name` text,`start_time` datetime,`end_time` datetime,`cancelled` numeric,`countdown_start_time` datetime,`xp_multiplier` real,`reward_coins` integer,`discord_end_message_id` text,`winner_user_id` text,`winner_user_name` text,`host_user_ambiguous` numeric,`winner_user_ambiguous` numeric,`host_user_resolution_method` text,`host_user_resolution_confidence` text,`winner_user_resolution_method` text,`winner_user_resolution_confidence` text,`source_import_id` integer,`source_message_id` text,CONSTRAINT `fk_games_host_user` FOREIGN KEY (`host_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_games_winner_user` FOREIGN KEY (`winner_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_games_source_import` FOREIGN KEY (`source_import_id`) REFERENCES `import_sources`(`id`));
+CREATE TABLE `rounds` (`id` integer PRIMARY KEY AUTOINCREMENT,`game_id` integer,`round_number` integer,`post_time` datetime,`discord_message_id` text,`source_import_id` integer,CONSTRAINT `fk_rounds_game` FOREIGN KEY (`game_id`) REFERENCES `games`(`id`),CONSTRAINT `fk_rounds_source_import` FOREIGN KEY (`source_import_id`) REFERENCES `import_sources`(`id`));
+CREATE UNIQUE INDEX `game_round_idx` ON `rounds`(`game_id`,`round_number`);
+CREATE TABLE `interaction_user_mentions` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` text,`user_name` text,`killed` numeric,`suffix` text,`user_ambiguous` numeric,`resolution_method` text,`resolution_confidence` text,CONSTRAINT `fk_interaction_user_mentions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+CREATE TABLE `interactions` (`id` integer PRIMARY KEY AUTOINCREMENT,`round_id` integer,`message_id` integer,`source_import_id` integer,`source_message_id` text,`source_line_index` integer,CONSTRAINT `fk_interactions_message` FOREIGN KEY (`message_id`) REFERENCES `interaction_messages`(`id`),CONSTRAINT `fk_interactions_source_import` FOREIGN KEY (`source_import_id`) REFERENCES `import_sources`(`id`),CONSTRAINT `fk_interactions_round` FOREIGN KEY (`round_id`) REFERENCES `rounds`(`id`));
+CREATE TABLE `interaction_item_mappings` (`interaction_id` integer,`item_name` text,PRIMARY KEY (`interaction_id`,`item_name`),CONSTRAINT `fk_interaction_item_mappings_interaction` FOREIGN KEY (`interaction_id`) REFERENCES `interactions`(`id`),CONSTRAINT `fk_interaction_item_mappings_item` FOREIGN KEY (`item_name`) REFERENCES `items`(`name`));
+CREATE TABLE `interaction_user_mention_mappings` (`interaction_id` integer,`interaction_user_mention_id` integer,PRIMARY KEY (`interaction_id`,`interaction_user_mention_id`),CONSTRAINT `fk_interaction_user_mention_mappings_interaction` FOREIGN KEY (`interaction_id`) REFERENCES `interactions`(`id`),CONSTRAINT `fk_interaction_user_mention_mappings_interaction_user_mention` FOREIGN KEY (`interaction_user_mention_id`) REFERENCES `interaction_user_mentions`(`id`));
@@ -0,0 +1,4 @@
+DROP VIEW `game_results`;
+DROP VIEW `player_game_participation`;
+DROP VIEW `interaction_details`;
+DROP VIEW `user_latest_names`;
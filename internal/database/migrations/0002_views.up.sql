@@ -0,0 +1,143 @@
+-- Convenience views so queries do not need to repeat the same joins.
+
+-- user_latest_names has the name each user was last observed with, name being
+-- the username and display_name the name shown in the server, if different.
+CREATE VIEW `user_latest_names` AS
+SELECT
+    u.id AS user_id,
+    u.player_id AS player_id,
+    (
+        SELECT uno.name
+        FROM user_name_observations uno
+        WHERE uno.user_id = u.id AND uno.kind = 'username'
+        ORDER BY uno.time DESC, uno.id DESC
+        LIMIT 1
+    ) AS name,
+    (
+        SELECT uno.name
+        FROM user_name_observations uno
+        WHERE uno.user_id = u.id AND uno.kind != 'username'
+        ORDER BY uno.time DESC, uno.id DESC
+        LIMIT 1
+    ) AS display_name
+FROM users u;
+
+-- interaction_details has one row per interaction with its game, round,
+-- template and the mentioned items and users joined in. Users are listed by
+-- their latest name, or the mentioned name if unresolved, separated by ";".
+CREATE VIEW `interaction_details` AS
+SELECT
+    i.id AS interaction_id,
+    r.game_id AS game_id,
+    i.round_id AS round_id,
+    r.round_number AS round_number,
+    r.post_time AS post_time,
+    m.event AS event,
+    m.text AS text,
+    (
+        SELECT GROUP_CONCAT(item_name, ';')
+        FROM (
+            SELECT im.item_name
+            FROM interaction_item_mappings im
+            WHERE im.interaction_id = i.id
+            ORDER BY im.item_name
+        )
+    ) AS items,
+    (
+        SELECT GROUP_CONCAT(name, ';')
+        FROM (
+            SELECT COALESCE(uln.name, um.user_name) AS name
+            FROM interaction_user_mention_mappings umm
+            JOIN interaction_user_mentions um
+                ON umm.interaction_user_mention_id = um.id
+            LEFT JOIN user_latest_names uln
+                ON um.user_id = uln.user_id
+            WHERE umm.interaction_id = i.id
+            ORDER BY um.id
+        )
+    ) AS users,
+    (
+        SELECT GROUP_CONCAT(name, ';')
+        FROM (
+            SELECT COALESCE(uln.name, um.user_name) AS name
+            FROM interaction_user_mention_mappings umm
+            JOIN interaction_user_mentions um
+                ON umm.interaction_user_mention_id = um.id
+            LEFT JOIN user_latest_names uln
+                ON um.user_id = uln.user_id
+            WHERE umm.interaction_id = i.id AND um.killed
+            ORDER BY um.id
+        )
+    ) AS killed_users,
+    i.source_message_id AS source_message_id,
+    i.source_line_index AS source_line_index
+FROM interactions i
+JOIN rounds r
+    ON i.round_id = r.id
+LEFT JOIN interaction_messages m
+    ON i.message_id = m.id;
+
+-- player_game_participation has one row per game each player took part in,
+-- either by being mentioned in an interaction or by winning.
+CREATE VIEW `player_game_participation` AS
+WITH participations AS (
+    SELECT r.game_id, um.user_id
+    FROM interactions i
+    JOIN rounds r
+        ON i.round_id = r.id
+    JOIN interaction_user_mention_mappings umm
+        ON i.id = umm.interaction_id
+    JOIN interaction_user_mentions um
+        ON umm.interaction_user_mention_id = um.id
+    WHERE um.user_id IS NOT NULL
+    UNION
+    SELECT g.id, g.winner_user_id
+    FROM games g
+    WHERE g.winner_user_id IS NOT NULL
+)
+SELECT
+    u.player_id AS player_id,
+    COALESCE(p.name, (
+        SELECT uln.name
+        FROM user_latest_names uln
+        WHERE uln.player_id = u.player_id
+        ORDER BY uln.user_id
+        LIMIT 1
+    )) AS player_name,
+    pa.game_id AS game_id,
+    MAX(g.winner_user_id IS NOT NULL AND g.winner_user_id = pa.user_id) AS won
+FROM participations pa
+JOIN users u
+    ON pa.user_id = u.id
+JOIN games g
+    ON pa.game_id = g.id
+LEFT JOIN players p
+    ON u.player_id = p.id
+GROUP BY u.player_id, pa.game_id;
+
+-- game_results has one row per game with its host, winner and the amount of
+-- rounds and participating players.
+CREATE VIEW `game_results` AS
+SELECT
+    g.id AS game_id,
+    g.discord_channel_id AS discord_channel_id,
+    g.discord_message_id AS discord_message_id,
+    g.era AS era,
+    g.countdown_start_time AS countdown_start_time,
+    g.start_time AS start_time,
+    g.end_time AS end_time,
+    g.cancelled AS cancelled,
+    g.host_user_id AS host_user_id,
+    COALESCE(host.name, g.host_user_name) AS host_name,
+    g.winner_user_id AS winner_user_id,
+    winner.player_id AS winner_player_id,
+    COALESCE(winner.name, g.winner_user_name) AS winner_name,
+    (SELECT COUNT(*) FROM rounds r WHERE r.game_id = g.id) AS rounds,
+    (SELECT COUNT(*) FROM player_game_participation pgp WHERE pgp.game_id = g.id) AS players,
+    g.xp_multiplier AS xp_multiplier,
+    g.reward_coins AS reward_coins
+FROM games g
+LEFT JOIN user_latest_names host
+    ON g.host_user_id = host.user_id
+LEFT JOIN user_latest_names winner
+    ON g.winner_user_id = winner.user_id;
@@ -0,0 +1,8 @@
+DROP TRIGGER `items_fts_update`;
+DROP TRIGGER `items_fts_delete`;
+DROP TRIGGER `items_fts_insert`;
+DROP TABLE `items_fts`;
+DROP TRIGGER `interaction_messages_fts_update`;
+DROP TRIGGER `interaction_messages_fts_delete`;
+DROP TRIGGER `interaction_messages_fts_insert`;
+DROP TABLE `interaction_messages_fts`;
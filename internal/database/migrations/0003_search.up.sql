@@ -0,0 +1,40 @@
+-- Full-text search over interaction templates, event titles and item names,
+-- kept up to date by triggers.
+
+CREATE VIRTUAL TABLE `interaction_messages_fts` USING fts5(
+    text,
+    event,
+    content='interaction_messages',
+    content_rowid='id'
+);
+
+CREATE TRIGGER `interaction_messages_fts_insert` AFTER INSERT ON `interaction_messages` BEGIN
+    INSERT INTO interaction_messages_fts (rowid, text, event) VALUES (new.id, new.text, new.event);
+END;
+
+CREATE TRIGGER `interaction_messages_fts_delete` AFTER DELETE ON `interaction_messages` BEGIN
+    INSERT INTO interaction_messages_fts (interaction_messages_fts, rowid, text, event) VALUES ('delete', old.id, old.text, old.event);
+END;
+
+CREATE TRIGGER `interaction_messages_fts_update` AFTER UPDATE ON `interaction_messages` BEGIN
+    INSERT INTO interaction_messages_fts (interaction_messages_fts, rowid, text, event) VALUES ('delete', old.id, old.text, old.event);
+    INSERT INTO interaction_messages_fts (rowid, text, event) VALUES (new.id, new.text, new.event);
+END;
+
+-- items have no stable rowid to refer to, so their index keeps its own copy
+CREATE VIRTUAL TABLE `items_fts` USING fts5(name);
+
+CREATE TRIGGER `items_fts_insert` AFTER INSERT ON `items` BEGIN
+    INSERT INTO items_fts (name) VALUES (new.name);
+END;
+
+CREATE TRIGGER `items_fts_delete` AFTER DELETE ON `items` BEGIN
+    DELETE FROM items_fts WHERE name = old.name;
+END;
+
+CREATE TRIGGER `items_fts_update` AFTER UPDATE ON `items` BEGIN
+    UPDATE items_fts SET name = new.name WHERE name = old.name;
+END;
+
+INSERT INTO interaction_messages_fts (interaction_messages_fts) VALUES ('rebuild');
+INSERT INTO items_fts (name) SELECT name FROM items;
@@ -0,0 +1,2 @@
+ALTER TABLE `interaction_user_mentions` DROP COLUMN `slot_index`;
+DROP TABLE `template_slots`;
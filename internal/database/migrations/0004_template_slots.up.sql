@@ -0,0 +1,62 @@
+-- Template slots make explicit which user or item fills which placeholder of
+-- an interaction template, rather than relying on the order of mentions.
+
+CREATE TABLE `template_slots` (`message_id` integer,`slot_index` integer,`kind` text,`role` text,`placeholder` text,PRIMARY KEY (`message_id`,`slot_index`),CONSTRAINT `fk_template_slots_message` FOREIGN KEY (`message_id`) REFERENCES `interaction_messages`(`id`));
+
+ALTER TABLE `interaction_user_mentions` ADD `slot_index` integer;
+
+-- slots of existing templates, numbered by the first appearance of their
+-- placeholder
+WITH RECURSIVE placeholders (message_id, position, placeholder, rest) AS (
+    SELECT id, 0, NULL, text
+    FROM interaction_messages
+    WHERE COALESCE(event, '') = ''
+    UNION ALL
+    SELECT
+        message_id,
+        position + 1,
+        substr(rest, instr(rest, '{{'), instr(substr(rest, instr(rest, '{{')), '}}') + 1),
+        substr(rest, instr(rest, '{{') + instr(substr(rest, instr(rest, '{{')), '}}') + 1)
+    FROM placeholders
+    WHERE instr(rest, '{{') > 0 AND instr(substr(rest, instr(rest, '{{')), '}}') > 0
+)
+INSERT INTO template_slots (message_id, slot_index, kind, role, placeholder)
+SELECT
+    message_id,
+    ROW_NUMBER() OVER (PARTITION BY message_id ORDER BY MIN(position)) - 1,
+    CASE WHEN placeholder = '{{item}}' THEN 'item' ELSE 'user' END,
+    CASE
+        WHEN placeholder = '{{item}}' THEN ''
+        WHEN placeholder = '{{users[0]}}' THEN 'actor'
+        ELSE 'target'
+    END,
+    placeholder
+FROM placeholders
+WHERE placeholder = '{{item}}' OR placeholder LIKE '{{users[%]}}'
+GROUP BY message_id, placeholder;
+
+-- users listed below an event description all share its only slot
+INSERT INTO template_slots (message_id, slot_index, kind, role, placeholder)
+SELECT id, 0, 'user', 'listed', ''
+FROM interaction_messages
+WHERE COALESCE(event, '') != '';
+
+-- mentions were stored in the order of their placeholders' indexes
+WITH numbered AS (
+    SELECT
+        umm.interaction_user_mention_id AS mention_id,
+        i.message_id AS message_id,
+        COALESCE(m.event, '') != '' AS event,
+        ROW_NUMBER() OVER (PARTITION BY umm.interaction_id ORDER BY umm.interaction_user_mention_id) - 1 AS n
+    FROM interaction_user_mention_mappings umm
+    JOIN interactions i ON i.id = umm.interaction_id
+    JOIN interaction_messages m ON m.id = i.message_id
+)
+UPDATE interaction_user_mentions SET slot_index = (
+    SELECT ts.slot_index
+    FROM numbered
+    JOIN template_slots ts
+        ON ts.message_id = numbered.message_id
+        AND ts.placeholder = CASE WHEN numbered.event THEN '' ELSE '{{users[' || numbered.n || ']}}' END
+    WHERE numbered.mention_id = interaction_user_mentions.id
+);
@@ -2,18 +2,122 @@ package database
 
 import "time"
 
+// Player is a person using one or more Discord accounts. Players with a name
+// come from the player file, every other account is a player of its own.
+type Player struct {
+	ID   int     `gorm:"primaryKey"`
+	Name *string `gorm:"uniqueIndex"`
+}
+
 type User struct {
-	ID string `gorm:"primaryKey"`
+	ID       string `gorm:"primaryKey"`
+	PlayerID *int
+	Player   *Player
+}
+
+// ImportSource is a single message export file that data was imported from.
+type ImportSource struct {
+	ID         int    `gorm:"primaryKey"`
+	Path       string `gorm:"index:import_source_idx,unique"`
+	Checksum   string `gorm:"index:import_source_idx,unique"`
+	ExportedAt time.Time
+	ChannelID  string
 }
 
+// Sources of user name observations.
+const (
+	// ObservationSourceMessage means the name was seen in an exported message.
+	ObservationSourceMessage = "message"
+	// ObservationSourceAlias means the name comes from the alias file.
+	ObservationSourceAlias = "alias"
+)
+
+// Kinds of user names, only usernames are unique at any point in time.
+const (
+	NameKindUsername = "username"
+	// NameKindGlobalName is the display name a user set for all servers.
+	NameKindGlobalName = "global-name"
+	// NameKindGuildNickname is the nickname a user set for the fan server.
+	NameKindGuildNickname = "guild-nickname"
+	// NameKindDisplayName is the name shown in the fan server when it is not
+	// known whether it is a global display name or a guild nickname, which is
+	// the case for DiscordChatExporter exports.
+	NameKindDisplayName = "display-name"
+)
+
 type UserNameObservation struct {
 	ID     int `gorm:"primaryKey"`
 	User   User
 	UserID string
 	Time   time.Time
 	Name   string
+	Kind   string `gorm:"default:username"`
+	Source string `gorm:"default:message"`
+	// ValidUntil is only known for aliases, observed names are valid until
+	// the next observation.
+	ValidUntil *time.Time
+	Note       string
+
+	SourceImportID  *int
+	SourceImport    *ImportSource
+	SourceMessageID string
+}
+
+// UserRoleObservation is one of the roles a user was observed with. All
+// observations of a user from the same message form the set of roles the user
+// had from then on, a single observation without a role means the user had no
+// roles at all.
+type UserRoleObservation struct {
+	ID           int `gorm:"primaryKey"`
+	User         User
+	UserID       string
+	Time         time.Time
+	RoleID       *string
+	RoleName     string
+	RoleColor    *string
+	RolePosition int
+
+	SourceImportID  *int
+	SourceImport    *ImportSource
+	SourceMessageID string
+}
+
+// UserAvatarObservation is an avatar a user was first seen with at that time.
+type UserAvatarObservation struct {
+	ID        int `gorm:"primaryKey"`
+	User      User
+	UserID    string
+	Time      time.Time
+	AvatarURL string
+
+	SourceImportID  *int
+	SourceImport    *ImportSource
+	SourceMessageID string
 }
 
+// Methods by which a user name was resolved to a user ID.
+const (
+	// ResolutionExactAtTime means the user was observed with the name at the
+	// time of the message.
+	ResolutionExactAtTime = "exact-at-time"
+	// ResolutionManualAlias means the name comes from the alias file.
+	ResolutionManualAlias = "manual-alias"
+	// ResolutionOnlyUserWithName means nobody was observed with the name at
+	// the time but only a single user ever had it.
+	ResolutionOnlyUserWithName = "only-user-with-name"
+	// ResolutionLaterBackfill means the name was only observed after the
+	// message and filled in afterwards.
+	ResolutionLaterBackfill = "later-backfill"
+)
+
+// Confidence levels of a user name resolution.
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+	ConfidenceNone   = "none"
+)
+
 type InteractionUserMention struct {
 	ID       int `gorm:"primaryKey"`
 	User     *User
@@ -21,6 +125,19 @@ type InteractionUserMention struct {
 	UserName string
 	Killed   bool
 	Suffix   string
+
+	// UserAmbiguous is set if several users had the name at the time, in
+	// which case UserID is left empty.
+	UserAmbiguous bool
+	// ResolutionMethod is empty and ResolutionConfidence is none as long as
+	// the user is not known.
+	ResolutionMethod     string
+	ResolutionConfidence string
+
+	// SlotIndex is the slot of the interaction's template the user fills, nil
+	// if it could not be told for mentions imported before slots existed. The
+	// column is added by a migration rather than AutoMigrate.
+	SlotIndex *int `gorm:"-:migration"`
 }
 
 type Item struct {
@@ -35,6 +152,13 @@ type Interaction struct {
 	MessageID    int
 	UserMentions []InteractionUserMention `gorm:"many2many:interaction_user_mention_mappings;"`
 	Items        []Item                   `gorm:"many2many:interaction_item_mappings;"`
+
+	SourceImportID  *int
+	SourceImport    *ImportSource
+	SourceMessageID string
+	// SourceLineIndex is the zero-based line within the embed description the
+	// interaction was parsed from.
+	SourceLineIndex int
 }
 
 type Round struct {
@@ -44,6 +168,9 @@ type Round struct {
 	RoundNumber      int `gorm:"index:game_round_idx,unique"`
 	PostTime         time.Time
 	DiscordMessageID string
+
+	SourceImportID *int
+	SourceImport   *ImportSource
 }
 
 type Game struct {
@@ -64,6 +191,27 @@ type Game struct {
 	WinnerUserID        *string
 	WinnerUser          *User
 	WinnerUserName      *string
+
+	// HostUserAmbiguous and WinnerUserAmbiguous are set if several users had
+	// the name at the time, see InteractionUserMention.
+	HostUserAmbiguous   bool
+	WinnerUserAmbiguous bool
+
+	// HostUserResolutionMethod and HostUserResolutionConfidence describe how
+	// HostUserID was found, see InteractionUserMention.
+	HostUserResolutionMethod     string
+	HostUserResolutionConfidence string
+
+	// WinnerUserResolutionMethod and WinnerUserResolutionConfidence describe
+	// how WinnerUserID was found, see InteractionUserMention.
+	WinnerUserResolutionMethod     string
+	WinnerUserResolutionConfidence string
+
+	// SourceImportID and SourceMessageID refer to the countdown message the
+	// game was first seen with.
+	SourceImportID  *int
+	SourceImport    *ImportSource
+	SourceMessageID string
 }
 
 type InteractionMessage struct {
@@ -71,3 +219,39 @@ type InteractionMessage struct {
 	Text  string `gorm:"index:interaction_message_text_idx,unique"`
 	Event string
 }
+
+// Kinds of template slots.
+const (
+	SlotKindUser = "user"
+	SlotKindItem = "item"
+	// SlotKindPronoun is reserved for pronouns, which are still kept as part
+	// of the template text for now.
+	SlotKindPronoun = "pronoun"
+)
+
+// Roles of user slots.
+const (
+	// SlotRoleActor is the first user of a line, usually the one acting.
+	SlotRoleActor = "actor"
+	// SlotRoleTarget is any other user of a line.
+	SlotRoleTarget = "target"
+	// SlotRoleListed is the single slot of an event shared by all users
+	// listed below its description.
+	SlotRoleListed = "listed"
+)
+
+// TemplateSlot is a place in an interaction template that is filled by a
+// mentioned user or item. Slots are numbered in the order their placeholders
+// first appear in the template.
+type TemplateSlot struct {
+	MessageID int `gorm:"primaryKey"`
+	Message   InteractionMessage
+	SlotIndex int `gorm:"primaryKey"`
+	Kind      string
+	// Role is empty for item slots.
+	Role string
+	// Placeholder stands in for the slot in the template text, e.g.
+	// {{users[0]}}. It is empty for the listed users of an event, who are
+	// not part of the text.
+	Placeholder string
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// pseudonymKind is how values of a column are replaced when pseudonymizing.
+type pseudonymKind int
+
+const (
+	// pseudonymID replaces Discord IDs with other numeric IDs.
+	pseudonymID pseudonymKind = iota
+	// pseudonymHandle replaces names and URLs with generated handles.
+	pseudonymHandle
+	// pseudonymTemplate replaces Discord IDs within text.
+	pseudonymTemplate
+	// pseudonymClear removes the value.
+	pseudonymClear
+)
+
+type pseudonymColumn struct {
+	table, column string
+	kind          pseudonymKind
+}
+
+// pseudonymColumns lists every column that identifies a user, directly or via
+// a link to the Discord message.
+var pseudonymColumns = []pseudonymColumn{
+	{"users", "id", pseudonymID},
+	{"players", "name", pseudonymHandle},
+	{"user_name_observations", "user_id", pseudonymID},
+	{"user_name_observations", "name", pseudonymHandle},
+	{"user_name_observations", "note", pseudonymClear},
+	{"user_name_observations", "source_message_id", pseudonymID},
+	{"user_role_observations", "user_id", pseudonymID},
+	{"user_role_observations", "source_message_id", pseudonymID},
+	{"user_avatar_observations", "user_id", pseudonymID},
+	{"user_avatar_observations", "avatar_url", pseudonymHandle},
+	{"user_avatar_observations", "source_message_id", pseudonymID},
+	{"interaction_messages", "text", pseudonymTemplate},
+	{"interaction_user_mentions", "user_id", pseudonymID},
+	{"interaction_user_mentions", "user_name", pseudonymHandle},
+	{"games", "discord_message_id", pseudonymID},
+	{"games", "discord_end_message_id", pseudonymID},
+	{"games", "host_user_id", pseudonymID},
+	{"games", "host_user_name", pseudonymHandle},
+	{"games", "winner_user_id", pseudonymID},
+	{"games", "winner_user_name", pseudonymHandle},
+	{"games", "source_message_id", pseudonymID},
+	{"rounds", "discord_message_id", pseudonymID},
+	{"interactions", "source_message_id", pseudonymID},
+}
+
+// rxSnowflake matches Discord IDs within text, e.g. in user mentions.
+var rxSnowflake = regexp.MustCompile(`\b\d{17,20}\b`)
+
+// pseudonymizer derives stable pseudonyms from a secret key, so the same
+// value always gets the same pseudonym and joins keep working.
+type pseudonymizer struct {
+	key []byte
+}
+
+func (p *pseudonymizer) sum(kind, value string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func (p *pseudonymizer) id(value string) string {
+	// keep it a positive 64-bit number like Discord IDs
+	return strconv.FormatUint(binary.BigEndian.Uint64(p.sum("id", value))>>1, 10)
+}
+
+func (p *pseudonymizer) handle(value string) string {
+	return "user-" + hex.EncodeToString(p.sum("handle", value)[:6])
+}
+
+func (p *pseudonymizer) replace(kind pseudonymKind, value string) string {
+	switch kind {
+	case pseudonymID:
+		return p.id(value)
+	case pseudonymHandle:
+		return p.handle(value)
+	case pseudonymTemplate:
+		return rxSnowflake.ReplaceAllStringFunc(value, p.id)
+	}
+	return ""
+}
+
+// Pseudonymize replaces all user IDs, names and Discord message IDs with
+// pseudonyms derived from the key. The same key always results in the same
+// pseudonyms, so dumps made with it can be compared, but without the key
+// pseudonyms can not be traced back.
+func (d *Database) Pseudonymize(key []byte) error {
+	if len(key) == 0 {
+		return fmt.Errorf("need a key to pseudonymize")
+	}
+	p := &pseudonymizer{key: key}
+	return d.db.Transaction(func(db *gorm.DB) error {
+		for _, c := range pseudonymColumns {
+			if !db.Migrator().HasColumn(c.table, c.column) {
+				continue
+			}
+			if c.kind == pseudonymClear {
+				if tx := db.Table(c.table).
+					Where(fmt.Sprintf("%q IS NOT NULL", c.column)).
+					Update(c.column, ""); tx.Error != nil {
+					return tx.Error
+				}
+				continue
+			}
+
+			var values []string
+			if tx := db.Table(c.table).
+				Distinct(c.column).
+				Where(fmt.Sprintf("%q IS NOT NULL AND %q != ''", c.column, c.column)).
+				Pluck(c.column, &values); tx.Error != nil {
+				return tx.Error
+			}
+			// map through a temporary table so a pseudonym that happens to
+			// equal another original value is not replaced again
+			if tx := db.Exec("CREATE TEMP TABLE pseudonyms (original TEXT PRIMARY KEY, pseudonym TEXT)"); tx.Error != nil {
+				return tx.Error
+			}
+			for _, value := range values {
+				if tx := db.Exec("INSERT INTO pseudonyms VALUES (?, ?)", value, p.replace(c.kind, value)); tx.Error != nil {
+					return tx.Error
+				}
+			}
+			if tx := db.Exec(fmt.Sprintf(
+				"UPDATE %[1]q SET %[2]q = (SELECT pseudonym FROM pseudonyms WHERE original = %[1]q.%[2]q) WHERE %[2]q IN (SELECT original FROM pseudonyms)",
+				c.table, c.column)); tx.Error != nil {
+				return tx.Error
+			}
+			if tx := db.Exec("DROP TABLE pseudonyms"); tx.Error != nil {
+				return tx.Error
+			}
+		}
+		return nil
+	})
+}
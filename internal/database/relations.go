@@ -0,0 +1,230 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Types of relation columns, independent of how SQLite stores them.
+const (
+	ColumnTypeInteger   = "integer"
+	ColumnTypeFloat     = "float"
+	ColumnTypeString    = "string"
+	ColumnTypeBoolean   = "boolean"
+	ColumnTypeTimestamp = "timestamp"
+)
+
+// timeLayouts are the formats times are stored in by the SQLite driver.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseTime parses a time as stored by the SQLite driver.
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Column is a column of a table or view.
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Nullable   bool   `json:"nullable"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+}
+
+// Relation is a table or view.
+type Relation struct {
+	Name    string   `json:"name"`
+	View    bool     `json:"view,omitempty"`
+	Columns []Column `json:"columns"`
+}
+
+// columnType maps the declared type of a column to a column type, or returns
+// an empty string if it can not tell.
+func columnType(declared string) string {
+	declared = strings.ToLower(declared)
+	switch {
+	case strings.Contains(declared, "int"):
+		return ColumnTypeInteger
+	case strings.Contains(declared, "real"), strings.Contains(declared, "floa"), strings.Contains(declared, "doub"):
+		return ColumnTypeFloat
+	case strings.Contains(declared, "date"), strings.Contains(declared, "time"):
+		return ColumnTypeTimestamp
+	case strings.Contains(declared, "bool"), declared == "numeric":
+		// booleans are declared as numeric by GORM
+		return ColumnTypeBoolean
+	case strings.Contains(declared, "char"), strings.Contains(declared, "text"), strings.Contains(declared, "clob"):
+		return ColumnTypeString
+	}
+	return ""
+}
+
+// Relations returns every table in the order they were created in, followed
+// by the views if requested. Full-text indexes are left out, they only hold
+// copies of other tables' data.
+func (d *Database) Relations(includeViews bool) ([]Relation, error) {
+	var objects []sqliteObject
+	if tx := d.db.Raw(sqliteObjectsQuery + ` AND m.type IN ('table', 'view') AND COALESCE(tl.type, '') != 'virtual'
+		ORDER BY m.type, m.rowid`).Scan(&objects); tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	relations := []Relation{}
+	for _, object := range objects {
+		if object.Type == "view" && !includeViews {
+			continue
+		}
+		var columns []struct {
+			Name    string
+			Type    string
+			NotNull bool
+			PK      int
+		}
+		if tx := d.db.Raw(fmt.Sprintf("SELECT name, type, \"notnull\" AS not_null, pk FROM pragma_table_info(%s) ORDER BY cid", quoteLiteral(object.Name))).Scan(&columns); tx.Error != nil {
+			return nil, tx.Error
+		}
+		relation := Relation{
+			Name:    object.Name,
+			View:    object.Type == "view",
+			Columns: []Column{},
+		}
+		for _, c := range columns {
+			column := Column{
+				Name:       c.Name,
+				Type:       columnType(c.Type),
+				Nullable:   !c.NotNull && c.PK == 0,
+				PrimaryKey: c.PK > 0,
+			}
+			if len(column.Type) == 0 {
+				// computed view columns have no declared type, go by the values
+				var types []string
+				if tx := d.db.Raw(fmt.Sprintf("SELECT DISTINCT typeof(%q) FROM %q", c.Name, object.Name)).Scan(&types); tx.Error != nil {
+					return nil, tx.Error
+				}
+				column.Type = ColumnTypeString
+				switch {
+				case slices.Contains(types, "text"), slices.Contains(types, "blob"):
+				case slices.Contains(types, "real"):
+					column.Type = ColumnTypeFloat
+				case slices.Contains(types, "integer"):
+					column.Type = ColumnTypeInteger
+				}
+			}
+			relation.Columns = append(relation.Columns, column)
+		}
+		relations = append(relations, relation)
+	}
+	return relations, nil
+}
+
+// ReadRelation calls fn for every row of the relation, ordered by primary key
+// or, for views, by the first column. Values are nil or of the Go type
+// matching the column type: int64, float64, string, bool or time.Time.
+func (d *Database) ReadRelation(relation Relation, fn func(row []any) error) error {
+	names := []string{}
+	orderBy := []string{}
+	for _, column := range relation.Columns {
+		names = append(names, fmt.Sprintf("%q", column.Name))
+		if column.PrimaryKey {
+			orderBy = append(orderBy, fmt.Sprintf("%q", column.Name))
+		}
+	}
+	if len(orderBy) == 0 {
+		orderBy = names[:1]
+	}
+	rows, err := d.db.Raw(fmt.Sprintf("SELECT %s FROM %q ORDER BY %s",
+		strings.Join(names, ","), relation.Name, strings.Join(orderBy, ","))).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(relation.Columns))
+	pointers := make([]any, len(relation.Columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		row := make([]any, len(values))
+		for i, column := range relation.Columns {
+			row[i], err = convertValue(column, values[i])
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", relation.Name, column.Name, err)
+			}
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// convertValue converts a value read from SQLite to the Go type matching the
+// column type.
+func convertValue(column Column, value any) (any, error) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	switch column.Type {
+	case ColumnTypeTimestamp:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			if t, ok := parseTime(v); ok {
+				return t, nil
+			}
+		}
+	case ColumnTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case float64:
+			return v != 0, nil
+		}
+	case ColumnTypeInteger:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case ColumnTypeFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		}
+	case ColumnTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.Format(timeLayouts[0]), nil
+		}
+		return fmt.Sprint(value), nil
+	}
+	return nil, fmt.Errorf("unexpected %T value for %s column", value, column.Type)
+}
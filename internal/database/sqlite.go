@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"reflect"
 	"slices"
 	"time"
 
@@ -70,19 +71,46 @@ func (d *Database) GORM() *gorm.DB {
 	return d.db
 }
 
+// entities is ordered so that every entity comes after the entities it
+// references, reversing it gives a safe order for deleting data.
 var entities []interface{} = []any{
+	&ImportSource{},
+	&Player{},
 	&User{},
 	&UserNameObservation{},
-	&InteractionUserMention{},
+	&UserRoleObservation{},
+	&UserAvatarObservation{},
 	&Item{},
 	&InteractionMessage{},
-	&Interaction{},
-	&Round{},
+	&TemplateSlot{},
 	&Game{},
+	&Round{},
+	&InteractionUserMention{},
+	&Interaction{},
 }
 
-func (d *Database) AutoMigrate() error {
-	return d.db.AutoMigrate(entities...)
+// userEntities are kept when resetting with keepUsers set. Import sources are
+// referenced by user observations so they are kept as well.
+var userEntities []interface{} = []any{
+	&ImportSource{},
+	&Player{},
+	&User{},
+	&UserNameObservation{},
+	&UserRoleObservation{},
+	&UserAvatarObservation{},
+}
+
+// CopyTo writes a consistent copy of the database to a new file.
+func (d *Database) CopyTo(path string) error {
+	return d.db.Exec("VACUUM INTO ?", path).Error
+}
+
+func (d *Database) Close() error {
+	db, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
 }
 
 func (d *Database) Export(out io.Writer) error {
@@ -90,24 +118,113 @@ func (d *Database) Export(out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	return sqlite3dump.DumpDB(
+	// the dump only drops tables and indexes, recreating views would fail
+	var views []string
+	if tx := d.db.Raw("SELECT name FROM sqlite_master WHERE type = 'view' ORDER BY name").Scan(&views); tx.Error != nil {
+		return tx.Error
+	}
+	for _, view := range views {
+		if _, err := fmt.Fprintf(out, "DROP VIEW IF EXISTS %q;\n", view); err != nil {
+			return err
+		}
+	}
+	if err := sqlite3dump.DumpDB(
 		db,
 		out,
 		sqlite3dump.WithTransaction(true),
-		sqlite3dump.WithDropIfExists(true))
+		sqlite3dump.WithDropIfExists(true)); err != nil {
+		return err
+	}
+	// the dump inserts into full-text indexes without their rowids, which
+	// breaks the link to the indexed rows until the index is rebuilt
+	var indexes []string
+	if tx := d.db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND sql LIKE 'CREATE VIRTUAL TABLE % USING fts5%' ORDER BY name").Scan(&indexes); tx.Error != nil {
+		return tx.Error
+	}
+	for _, index := range indexes {
+		if _, err := fmt.Fprintf(out, "INSERT INTO %q (%q) VALUES ('rebuild');\n", index, index); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (d *Database) Reset() error {
+// Reset deletes all data in foreign key order and resets the SQLite
+// autoincrement sequences so the next import starts counting from scratch.
+// If keepUsers is set, everything in userEntities is left untouched, i.e.
+// import sources, players, users and their name, role and avatar
+// observations. Observations from the alias file are updated in place by the
+// next import.
+func (d *Database) Reset(keepUsers bool) error {
 	reversedEntities := make([]any, len(entities))
 	copy(reversedEntities, entities)
 	slices.Reverse(reversedEntities)
-	for _, entity := range entities {
+
+	tableNames := []string{}
+	for _, entity := range reversedEntities {
+		if keepUsers && slices.ContainsFunc(userEntities, func(e any) bool {
+			return reflect.TypeOf(e) == reflect.TypeOf(entity)
+		}) {
+			continue
+		}
 		stmt := &gorm.Statement{DB: d.db}
-		stmt.Parse(entity)
-		tableName := stmt.Schema.Table
-		if tx := d.db.Raw(fmt.Sprintf("TRUNCATE TABLE  %s;", tableName)); tx.Error != nil {
-			return tx.Error
+		if err := stmt.Parse(entity); err != nil {
+			return err
 		}
+		// join tables reference the entity so they need to go first
+		for _, rel := range stmt.Schema.Relationships.Many2Many {
+			tableNames = append(tableNames, rel.JoinTable.Table)
+		}
+		tableNames = append(tableNames, stmt.Schema.Table)
 	}
-	return nil
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, tableName := range tableNames {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %q;", tableName)).Error; err != nil {
+				return err
+			}
+		}
+
+		// sqlite_sequence only exists once a table with AUTOINCREMENT was created
+		if !tx.Migrator().HasTable("sqlite_sequence") {
+			return nil
+		}
+		if err := tx.Exec("DELETE FROM sqlite_sequence WHERE name IN ?;", tableNames).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteGame deletes a game along with its rounds and their interactions, so
+// that it can be processed again. Users, observations and templates are left
+// untouched. Autoincrement sequences are set back as far as possible so that
+// processing the latest game again hands out the same IDs.
+func (d *Database) DeleteGame(id int) error {
+	interactions := `SELECT i.id FROM interactions i JOIN rounds r ON r.id = i.round_id WHERE r.game_id = ?`
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			`DELETE FROM interaction_user_mentions WHERE id IN (
+				SELECT interaction_user_mention_id FROM interaction_user_mention_mappings WHERE interaction_id IN (` + interactions + `))`,
+			`DELETE FROM interaction_user_mention_mappings WHERE interaction_id IN (` + interactions + `)`,
+			`DELETE FROM interaction_item_mappings WHERE interaction_id IN (` + interactions + `)`,
+			`DELETE FROM interactions WHERE id IN (` + interactions + `)`,
+			`DELETE FROM rounds WHERE game_id = ?`,
+			`DELETE FROM games WHERE id = ?`,
+		} {
+			if err := tx.Exec(stmt, id).Error; err != nil {
+				return err
+			}
+		}
+
+		if !tx.Migrator().HasTable("sqlite_sequence") {
+			return nil
+		}
+		for _, table := range []string{"interaction_user_mentions", "interactions", "rounds", "games"} {
+			if err := tx.Exec(fmt.Sprintf("UPDATE sqlite_sequence SET seq = (SELECT COALESCE(MAX(id), 0) FROM %q) WHERE name = ?", table), table).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,701 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAPIBaseURL = "https://discord.com/api/v10"
+	cdnBaseURL        = "https://cdn.discordapp.com"
+
+	// maxMessagesPerPage is the maximum amount of messages Discord returns per
+	// request.
+	maxMessagesPerPage = 100
+
+	// maxRateLimitRetries is how often a rate limited request is retried
+	// before giving up.
+	maxRateLimitRetries = 5
+)
+
+// minRateLimitWait is the least time to wait before retrying a rate limited
+// request, doubled with every retry so that an endpoint that keeps answering
+// without telling how long to wait is not hammered.
+var minRateLimitWait = 500 * time.Millisecond
+
+// Client is a minimal Discord REST API client that can fetch channel history
+// in the same format as DiscordChatExporter.
+type Client struct {
+	// BaseURL is the API base URL, defaults to DefaultAPIBaseURL.
+	BaseURL string
+	// Token is sent as-is in the Authorization header, bot tokens need to be
+	// prefixed with "Bot ".
+	Token      string
+	HTTPClient *http.Client
+
+	roles   map[string]map[string]apiRole
+	members map[string]*apiMember
+}
+
+// NewClient returns a client talking to the given API base URL.
+func NewClient(baseURL, token string) *Client {
+	if len(baseURL) == 0 {
+		baseURL = DefaultAPIBaseURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+		roles:      map[string]map[string]apiRole{},
+		members:    map[string]*apiMember{},
+	}
+}
+
+type apiError struct {
+	StatusCode int     `json:"-"`
+	Code       int     `json:"code"`
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+}
+
+func (e *apiError) Error() string {
+	if len(e.Message) == 0 {
+		return http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v any) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	for retry := 0; ; retry++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", c.Token)
+		req.Header.Set("User-Agent", "hololive-bettel-royale-data-processing")
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && retry < maxRateLimitRetries {
+			var apiErr apiError
+			_ = json.Unmarshal(body, &apiErr)
+			wait := parseSeconds(resp.Header.Get("Retry-After"))
+			if apiErr.RetryAfter > 0 {
+				wait = time.Duration(apiErr.RetryAfter * float64(time.Second))
+			}
+			wait = max(wait, minRateLimitWait<<retry)
+			log.Printf("WARNING: Rate limited on %s, retrying in %s", path, wait)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// wait out the bucket before the next request would run into it
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if err := sleep(ctx, parseSeconds(resp.Header.Get("X-RateLimit-Reset-After"))); err != nil {
+				return err
+			}
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			apiErr := &apiError{}
+			_ = json.Unmarshal(body, apiErr)
+			apiErr.StatusCode = resp.StatusCode
+			return fmt.Errorf("GET %s: %w", path, apiErr)
+		}
+		return json.Unmarshal(body, v)
+	}
+}
+
+func parseSeconds(s string) time.Duration {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds < 0 {
+		return time.Second
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type apiUser struct {
+	ID            string  `json:"id"`
+	Username      string  `json:"username"`
+	Discriminator string  `json:"discriminator"`
+	GlobalName    *string `json:"global_name"`
+	Avatar        *string `json:"avatar"`
+	Bot           bool    `json:"bot"`
+}
+
+type apiMember struct {
+	User  *apiUser `json:"user"`
+	Nick  *string  `json:"nick"`
+	Roles []string `json:"roles"`
+}
+
+type apiRole struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Color    int    `json:"color"`
+	Position int    `json:"position"`
+}
+
+type apiGuild struct {
+	ID   string  `json:"id"`
+	Name string  `json:"name"`
+	Icon *string `json:"icon"`
+}
+
+type apiChannel struct {
+	ID       string  `json:"id"`
+	Type     int     `json:"type"`
+	GuildID  string  `json:"guild_id"`
+	Name     string  `json:"name"`
+	Topic    *string `json:"topic"`
+	ParentID *string `json:"parent_id"`
+}
+
+type apiEmbedMedia struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type apiEmbed struct {
+	Title       string          `json:"title"`
+	URL         *string         `json:"url"`
+	Timestamp   *string         `json:"timestamp"`
+	Description string          `json:"description"`
+	Color       *int            `json:"color"`
+	Thumbnail   *apiEmbedMedia  `json:"thumbnail"`
+	Image       *apiEmbedMedia  `json:"image"`
+	Fields      []apiEmbedField `json:"fields"`
+	Footer      *struct {
+		Text    string `json:"text"`
+		IconURL string `json:"icon_url"`
+	} `json:"footer"`
+	Author *struct {
+		Name    string  `json:"name"`
+		URL     *string `json:"url"`
+		IconURL string  `json:"icon_url"`
+	} `json:"author"`
+}
+
+type apiEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type apiEmoji struct {
+	ID       *string `json:"id"`
+	Name     string  `json:"name"`
+	Animated bool    `json:"animated"`
+}
+
+type apiReaction struct {
+	Count int      `json:"count"`
+	Emoji apiEmoji `json:"emoji"`
+}
+
+type apiMessage struct {
+	ID               string        `json:"id"`
+	ChannelID        string        `json:"channel_id"`
+	GuildID          string        `json:"guild_id"`
+	Type             int           `json:"type"`
+	Content          string        `json:"content"`
+	Timestamp        time.Time     `json:"timestamp"`
+	EditedTimestamp  *time.Time    `json:"edited_timestamp"`
+	Pinned           bool          `json:"pinned"`
+	Author           apiUser       `json:"author"`
+	Member           *apiMember    `json:"member"`
+	Attachments      []any         `json:"attachments"`
+	Embeds           []apiEmbed    `json:"embeds"`
+	StickerItems     []any         `json:"sticker_items"`
+	Reactions        []apiReaction `json:"reactions"`
+	Mentions         []apiUser     `json:"mentions"`
+	MessageReference *struct {
+		MessageID string `json:"message_id"`
+		ChannelID string `json:"channel_id"`
+		GuildID   string `json:"guild_id"`
+	} `json:"message_reference"`
+	Interaction *struct {
+		ID   string  `json:"id"`
+		Name string  `json:"name"`
+		User apiUser `json:"user"`
+	} `json:"interaction"`
+}
+
+// messageTypes maps the Discord message type to the names used by
+// DiscordChatExporter.
+var messageTypes = map[int]string{
+	0:  "Default",
+	1:  "RecipientAdd",
+	2:  "RecipientRemove",
+	3:  "Call",
+	4:  "ChannelNameChange",
+	5:  "ChannelIconChange",
+	6:  "ChannelPinnedMessage",
+	7:  "GuildMemberJoin",
+	18: "ThreadCreated",
+	19: "Reply",
+	20: "ChatInputCommand",
+	23: "ContextMenuCommand",
+}
+
+// channelTypes maps the Discord channel type to the names used by
+// DiscordChatExporter.
+var channelTypes = map[int]string{
+	0:  "GuildTextChat",
+	1:  "DirectTextChat",
+	2:  "GuildVoiceChat",
+	3:  "DirectGroupTextChat",
+	4:  "GuildCategory",
+	5:  "GuildNews",
+	10: "GuildNewsThread",
+	11: "GuildPublicThread",
+	12: "GuildPrivateThread",
+	13: "GuildStageVoice",
+	15: "GuildForum",
+}
+
+// FetchChannelInfo returns an empty backup of the channel that only has the
+// guild and channel metadata filled out.
+func (c *Client) FetchChannelInfo(ctx context.Context, channelID string) (*Backup, error) {
+	var channel apiChannel
+	if err := c.get(ctx, "/channels/"+channelID, nil, &channel); err != nil {
+		return nil, err
+	}
+	backup := &Backup{
+		Channel: Channel{
+			ID:   channel.ID,
+			Type: channelTypes[channel.Type],
+			Name: channel.Name,
+		},
+		Messages: []Message{},
+	}
+	if channel.Topic != nil {
+		backup.Channel.Topic = *channel.Topic
+	}
+	if channel.ParentID != nil {
+		var category apiChannel
+		if err := c.get(ctx, "/channels/"+*channel.ParentID, nil, &category); err != nil {
+			return nil, err
+		}
+		backup.Channel.CategoryID = category.ID
+		backup.Channel.Category = category.Name
+	}
+	if len(channel.GuildID) > 0 {
+		var guild apiGuild
+		if err := c.get(ctx, "/guilds/"+channel.GuildID, nil, &guild); err != nil {
+			return nil, err
+		}
+		backup.Guild = Guild{
+			ID:   guild.ID,
+			Name: guild.Name,
+		}
+		if guild.Icon != nil {
+			backup.Guild.IconURL = fmt.Sprintf("%s/icons/%s/%s%s?size=512", cdnBaseURL, guild.ID, *guild.Icon, imageExt(*guild.Icon))
+		}
+	}
+	return backup, nil
+}
+
+// FetchMessage fetches a single message of a channel.
+func (c *Client) FetchMessage(ctx context.Context, guildID, channelID, messageID string) (Message, error) {
+	var m apiMessage
+	if err := c.get(ctx, "/channels/"+channelID+"/messages/"+messageID, nil, &m); err != nil {
+		return Message{}, err
+	}
+	return c.convertMessage(ctx, guildID, m)
+}
+
+// FetchChannel fetches the channel metadata and all messages after the given
+// message ID (or from the beginning if empty) in chronological order. If
+// before is not empty, messages from that ID on are left out.
+func (c *Client) FetchChannel(ctx context.Context, channelID, after, before string) (*Backup, error) {
+	backup, err := c.FetchChannelInfo(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(after) == 0 {
+		after = "0"
+	}
+	for {
+		// Discord only takes one of after and before, so the upper bound is
+		// applied here
+		query := url.Values{}
+		query.Set("after", after)
+		query.Set("limit", strconv.Itoa(maxMessagesPerPage))
+		var page []apiMessage
+		if err := c.get(ctx, "/channels/"+channelID+"/messages", query, &page); err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		slices.SortFunc(page, func(a, b apiMessage) int {
+			return CompareIDs(a.ID, b.ID)
+		})
+		done := len(page) < maxMessagesPerPage
+		if len(before) > 0 {
+			if n := slices.IndexFunc(page, func(m apiMessage) bool {
+				return CompareIDs(m.ID, before) >= 0
+			}); n >= 0 {
+				page, done = page[:n], true
+			}
+		}
+		for _, m := range page {
+			msg, err := c.convertMessage(ctx, backup.Guild.ID, m)
+			if err != nil {
+				return nil, err
+			}
+			backup.Messages = append(backup.Messages, msg)
+		}
+		if len(page) > 0 {
+			after = page[len(page)-1].ID
+			log.Printf("Fetched %d messages from channel %s up to %s", len(backup.Messages), channelID, after)
+		}
+		if done {
+			break
+		}
+	}
+
+	backup.ExportedAt = time.Now().UTC()
+	backup.MessageCount = len(backup.Messages)
+	return backup, nil
+}
+
+func (c *Client) guildRoles(ctx context.Context, guildID string) (map[string]apiRole, error) {
+	if roles, ok := c.roles[guildID]; ok {
+		return roles, nil
+	}
+	var roleList []apiRole
+	if err := c.get(ctx, "/guilds/"+guildID+"/roles", nil, &roleList); err != nil {
+		return nil, err
+	}
+	roles := map[string]apiRole{}
+	for _, role := range roleList {
+		roles[role.ID] = role
+	}
+	c.roles[guildID] = roles
+	return roles, nil
+}
+
+// member returns the guild member for the user or nil if the user is no
+// longer part of the guild.
+func (c *Client) member(ctx context.Context, guildID, userID string) (*apiMember, error) {
+	key := guildID + "/" + userID
+	if member, ok := c.members[key]; ok {
+		return member, nil
+	}
+	var member *apiMember
+	var apiErr *apiError
+	err := c.get(ctx, "/guilds/"+guildID+"/members/"+userID, nil, &member)
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		// users who left the guild can't be looked up anymore
+		member = nil
+	} else if err != nil {
+		return nil, err
+	}
+	c.members[key] = member
+	return member, nil
+}
+
+func (c *Client) convertUser(ctx context.Context, guildID string, u apiUser) (User, error) {
+	user := User{
+		ID:            u.ID,
+		Name:          u.Username,
+		Discriminator: u.Discriminator,
+		IsBot:         u.Bot,
+		AvatarURL:     avatarURL(u),
+	}
+	if u.GlobalName != nil {
+		user.GlobalName = *u.GlobalName
+		user.Nickname = *u.GlobalName
+	} else {
+		user.Nickname = u.Username
+	}
+	if len(user.Discriminator) == 0 || user.Discriminator == "0" {
+		user.Discriminator = "0000"
+	}
+	if len(guildID) == 0 {
+		return user, nil
+	}
+
+	member, err := c.member(ctx, guildID, u.ID)
+	if err != nil {
+		return user, err
+	}
+	if member == nil {
+		// unknown roles, not no roles
+		return user, nil
+	}
+	user.Roles = []Role{}
+	if member.Nick != nil {
+		user.Nickname = *member.Nick
+	}
+	roles, err := c.guildRoles(ctx, guildID)
+	if err != nil {
+		return user, err
+	}
+	for _, roleID := range member.Roles {
+		role, ok := roles[roleID]
+		if !ok {
+			continue
+		}
+		user.Roles = append(user.Roles, Role{
+			ID:       role.ID,
+			Name:     role.Name,
+			Color:    colorString(role.Color),
+			Position: role.Position,
+		})
+	}
+	// highest role comes first, its color is the user's color
+	slices.SortFunc(user.Roles, func(a, b Role) int {
+		return b.Position - a.Position
+	})
+	for _, role := range user.Roles {
+		if color, ok := role.Color.(string); ok {
+			user.Color = color
+			break
+		}
+	}
+	return user, nil
+}
+
+func (c *Client) convertMessage(ctx context.Context, guildID string, m apiMessage) (Message, error) {
+	author, err := c.convertUser(ctx, guildID, m.Author)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{
+		ID:              m.ID,
+		Type:            messageTypes[m.Type],
+		Timestamp:       m.Timestamp,
+		TimestampEdited: m.EditedTimestamp,
+		IsPinned:        m.Pinned,
+		Content:         m.Content,
+		Author:          Author(author),
+		Attachments:     m.Attachments,
+		Embeds:          []Embed{},
+		Stickers:        m.StickerItems,
+		Reactions:       []Reaction{},
+		Mentions:        []User{},
+	}
+	if len(msg.Type) == 0 {
+		msg.Type = strconv.Itoa(m.Type)
+	}
+	if msg.Attachments == nil {
+		msg.Attachments = []any{}
+	}
+	if msg.Stickers == nil {
+		msg.Stickers = []any{}
+	}
+	for _, e := range m.Embeds {
+		msg.Embeds = append(msg.Embeds, convertEmbed(e))
+	}
+	for _, mention := range m.Mentions {
+		user, err := c.convertUser(ctx, guildID, mention)
+		if err != nil {
+			return msg, err
+		}
+		msg.Mentions = append(msg.Mentions, user)
+	}
+	for _, r := range m.Reactions {
+		reaction, err := c.convertReaction(ctx, guildID, m, r)
+		if err != nil {
+			return msg, err
+		}
+		msg.Reactions = append(msg.Reactions, reaction)
+	}
+	if m.MessageReference != nil {
+		msg.Reference = &Reference{
+			MessageID: m.MessageReference.MessageID,
+			ChannelID: m.MessageReference.ChannelID,
+			GuildID:   m.MessageReference.GuildID,
+		}
+	}
+	if m.Interaction != nil {
+		user, err := c.convertUser(ctx, guildID, m.Interaction.User)
+		if err != nil {
+			return msg, err
+		}
+		msg.Interaction = &Interaction{
+			ID:   m.Interaction.ID,
+			Name: m.Interaction.Name,
+			User: user,
+		}
+	}
+	return msg, nil
+}
+
+func (c *Client) convertReaction(ctx context.Context, guildID string, m apiMessage, r apiReaction) (Reaction, error) {
+	reaction := Reaction{
+		Emoji: Emoji{
+			Name:       r.Emoji.Name,
+			Code:       r.Emoji.Name,
+			IsAnimated: r.Emoji.Animated,
+		},
+		Count: r.Count,
+		Users: []User{},
+	}
+	emoji := r.Emoji.Name
+	if r.Emoji.ID != nil {
+		reaction.Emoji.ID = *r.Emoji.ID
+		reaction.Emoji.ImageURL = fmt.Sprintf("%s/emojis/%s.%s", cdnBaseURL, *r.Emoji.ID, map[bool]string{false: "png", true: "gif"}[r.Emoji.Animated])
+		emoji += ":" + *r.Emoji.ID
+	}
+
+	after := ""
+	for {
+		query := url.Values{}
+		query.Set("limit", "100")
+		if len(after) > 0 {
+			query.Set("after", after)
+		}
+		var users []apiUser
+		if err := c.get(ctx, "/channels/"+m.ChannelID+"/messages/"+m.ID+"/reactions/"+url.PathEscape(emoji), query, &users); err != nil {
+			return reaction, err
+		}
+		for _, u := range users {
+			user, err := c.convertUser(ctx, guildID, u)
+			if err != nil {
+				return reaction, err
+			}
+			reaction.Users = append(reaction.Users, user)
+		}
+		if len(users) < 100 {
+			break
+		}
+		after = users[len(users)-1].ID
+	}
+	return reaction, nil
+}
+
+func convertEmbed(e apiEmbed) Embed {
+	embed := Embed{
+		Title:       e.Title,
+		Description: e.Description,
+		Images:      []any{},
+		Fields:      []any{},
+	}
+	if e.URL != nil {
+		embed.URL = *e.URL
+	}
+	if e.Timestamp != nil {
+		embed.Timestamp = *e.Timestamp
+	}
+	if e.Color != nil {
+		embed.Color = fmt.Sprintf("#%06X", *e.Color)
+	}
+	if e.Thumbnail != nil {
+		embed.Thumbnail = Thumbnail(*e.Thumbnail)
+	}
+	if e.Image != nil {
+		embed.Images = append(embed.Images, Thumbnail(*e.Image))
+	}
+	for _, f := range e.Fields {
+		embed.Fields = append(embed.Fields, Fields{
+			Name:     f.Name,
+			Value:    f.Value,
+			IsInline: f.Inline,
+		})
+	}
+	if e.Footer != nil {
+		embed.Footer = &Footer{
+			Text:    e.Footer.Text,
+			IconURL: e.Footer.IconURL,
+		}
+	}
+	if e.Author != nil {
+		embed.Author = EmbedAuthor{
+			Name:    e.Author.Name,
+			IconURL: e.Author.IconURL,
+		}
+		if e.Author.URL != nil {
+			embed.Author.URL = *e.Author.URL
+		}
+	}
+	return embed
+}
+
+// colorString formats a Discord color as hex string, 0 means no color.
+func colorString(color int) any {
+	if color == 0 {
+		return nil
+	}
+	return fmt.Sprintf("#%06X", color)
+}
+
+func imageExt(hash string) string {
+	if strings.HasPrefix(hash, "a_") {
+		return ".gif"
+	}
+	return ".png"
+}
+
+func avatarURL(u apiUser) string {
+	if u.Avatar == nil {
+		// default avatars of legacy accounts still go by their discriminator
+		index := uint64(0)
+		if discriminator, err := strconv.ParseUint(u.Discriminator, 10, 64); err == nil && discriminator != 0 {
+			index = discriminator % 5
+		} else if id, err := strconv.ParseUint(u.ID, 10, 64); err == nil {
+			index = (id >> 22) % 6
+		}
+		return fmt.Sprintf("%s/embed/avatars/%d.png", cdnBaseURL, index)
+	}
+	return fmt.Sprintf("%s/avatars/%s/%s%s?size=512", cdnBaseURL, u.ID, *u.Avatar, imageExt(*u.Avatar))
+}
+
+// CompareIDs compares two Discord snowflake IDs numerically. IDs that are not
+// numeric sort before all numeric ones.
+func CompareIDs(a, b string) int {
+	ai, aErr := strconv.ParseUint(a, 10, 64)
+	bi, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr != nil && bErr != nil:
+		return strings.Compare(a, b)
+	case aErr != nil:
+		return -1
+	case bErr != nil:
+		return 1
+	case ai < bi:
+		return -1
+	case ai > bi:
+		return 1
+	}
+	return 0
+}
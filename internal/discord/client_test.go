@@ -0,0 +1,327 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testGuildID   = "100"
+	testChannelID = "200"
+	testUserID    = "300"
+	testLeftID    = "301"
+)
+
+// testAPI is a stand-in for the Discord API serving a single channel with
+// numbered messages.
+type testAPI struct {
+	t        *testing.T
+	messages int
+
+	mu sync.Mutex
+	// afters are the after query parameters of all message page requests.
+	afters []string
+	// rateLimited maps request paths to how many more times they answer with
+	// 429 before succeeding.
+	rateLimited map[string]int
+	// retryAfterHeader and retryAfterBody are sent with 429 responses.
+	retryAfterHeader string
+	retryAfterBody   float64
+	requests         map[string]int
+	// dispatches are sent by the gateway once the client identified.
+	dispatches []gatewayPayload
+}
+
+func newTestAPI(t *testing.T, messages int) (*testAPI, *Client) {
+	api := &testAPI{
+		t:           t,
+		messages:    messages,
+		rateLimited: map[string]int{},
+		requests:    map[string]int{},
+	}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	wait := minRateLimitWait
+	minRateLimitWait = time.Millisecond
+	t.Cleanup(func() { minRateLimitWait = wait })
+
+	return api, NewClient(server.URL+"/", "Bot token")
+}
+
+func (api *testAPI) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		api.t.Error(err)
+	}
+}
+
+func (api *testAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the gateway gets the token when identifying instead
+	if r.URL.Path == "/gateway" {
+		api.serveGateway(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bot token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	api.mu.Lock()
+	api.requests[r.URL.Path]++
+	rateLimited := api.rateLimited[r.URL.Path] > 0
+	if rateLimited {
+		api.rateLimited[r.URL.Path]--
+	}
+	api.mu.Unlock()
+	if rateLimited {
+		if len(api.retryAfterHeader) > 0 {
+			w.Header().Set("Retry-After", api.retryAfterHeader)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		api.writeJSON(w, map[string]any{"message": "You are being rate limited.", "retry_after": api.retryAfterBody})
+		return
+	}
+
+	nick := "Guild Nick"
+	icon := "a_icon"
+	topic := "Topic"
+	parentID := "199"
+	switch r.URL.Path {
+	case "/channels/" + testChannelID:
+		api.writeJSON(w, apiChannel{ID: testChannelID, GuildID: testGuildID, Name: "battle-royale", Topic: &topic, ParentID: &parentID})
+	case "/channels/" + parentID:
+		api.writeJSON(w, apiChannel{ID: parentID, Type: 4, GuildID: testGuildID, Name: "Games"})
+	case "/guilds/" + testGuildID:
+		api.writeJSON(w, apiGuild{ID: testGuildID, Name: "Fan Server", Icon: &icon})
+	case "/guilds/" + testGuildID + "/roles":
+		api.writeJSON(w, []apiRole{
+			{ID: "1", Name: "Member", Color: 0x00ff00, Position: 1},
+			{ID: "2", Name: "Moderator", Color: 0xff0000, Position: 2},
+			{ID: "3", Name: "Uncolored", Position: 3},
+		})
+	case "/guilds/" + testGuildID + "/members/" + testUserID:
+		api.writeJSON(w, apiMember{Nick: &nick, Roles: []string{"1", "2", "3"}})
+	case "/guilds/" + testGuildID + "/members/" + testLeftID:
+		w.WriteHeader(http.StatusNotFound)
+		api.writeJSON(w, map[string]any{"message": "Unknown Member", "code": 10007})
+	case "/channels/" + testChannelID + "/messages":
+		after, err := strconv.Atoi(r.URL.Query().Get("after"))
+		if err != nil {
+			api.t.Errorf("bad after parameter %q", r.URL.Query().Get("after"))
+		}
+		if len(r.URL.Query().Get("before")) > 0 {
+			api.t.Errorf("before and after passed at once")
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		api.mu.Lock()
+		api.afters = append(api.afters, r.URL.Query().Get("after"))
+		api.mu.Unlock()
+		// newest first, like Discord does
+		page := []apiMessage{}
+		for id := min(after+limit, api.messages); id > after; id-- {
+			page = append(page, testMessage(id))
+		}
+		api.writeJSON(w, page)
+	default:
+		// single messages are always served in their edited version
+		if id, ok := strings.CutPrefix(r.URL.Path, "/channels/"+testChannelID+"/messages/"); ok {
+			if n, err := strconv.Atoi(id); err == nil {
+				m := testMessage(n)
+				m.Content = "edited " + m.Content
+				edited := m.Timestamp.Add(time.Hour)
+				m.EditedTimestamp = &edited
+				api.writeJSON(w, m)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testMessage(id int) apiMessage {
+	globalName := "Global"
+	return apiMessage{
+		ID:        strconv.Itoa(id),
+		ChannelID: testChannelID,
+		Type:      0,
+		Content:   fmt.Sprintf("message %d", id),
+		Timestamp: time.Date(2024, 1, 1, 0, 0, id, 0, time.UTC),
+		Author:    apiUser{ID: testUserID, Username: "user", GlobalName: &globalName},
+		Mentions:  []apiUser{{ID: testLeftID, Username: "left", Discriminator: "1234"}},
+	}
+}
+
+func messageIDs(backup *Backup) []string {
+	ids := []string{}
+	for _, m := range backup.Messages {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestFetchChannelPagesAfter(t *testing.T) {
+	api, client := newTestAPI(t, 250)
+
+	backup, err := client.FetchChannel(context.Background(), testChannelID, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0", "100", "200"}; !slices.Equal(api.afters, want) {
+		t.Errorf("requested pages after %v, want %v", api.afters, want)
+	}
+	if len(backup.Messages) != 250 || backup.MessageCount != 250 {
+		t.Fatalf("got %d messages (count %d), want 250", len(backup.Messages), backup.MessageCount)
+	}
+	if !slices.IsSortedFunc(messageIDs(backup), CompareIDs) {
+		t.Errorf("messages not in chronological order: %v", messageIDs(backup))
+	}
+}
+
+func TestFetchChannelAfterAndBefore(t *testing.T) {
+	api, client := newTestAPI(t, 250)
+
+	backup, err := client.FetchChannel(context.Background(), testChannelID, "42", "180")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the page running into the upper bound is the last one requested
+	if want := []string{"42", "142"}; !slices.Equal(api.afters, want) {
+		t.Errorf("requested pages after %v, want %v", api.afters, want)
+	}
+	ids := messageIDs(backup)
+	if len(ids) != 137 || ids[0] != "43" || ids[len(ids)-1] != "179" {
+		t.Errorf("got messages %s to %s (%d), want 43 to 179 (137)", ids[0], ids[len(ids)-1], len(ids))
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		header string
+		body   float64
+		want   time.Duration
+	}{
+		{name: "header", header: "0.05", want: 100 * time.Millisecond},
+		{name: "body", header: "1", body: 0.05, want: 100 * time.Millisecond},
+		// the minimum wait doubles with every retry
+		{name: "zero", header: "0", want: 3 * time.Millisecond},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			api, client := newTestAPI(t, 0)
+			api.retryAfterHeader = test.header
+			api.retryAfterBody = test.body
+			api.rateLimited["/guilds/"+testGuildID] = 2
+
+			start := time.Now()
+			var guild apiGuild
+			if err := client.get(context.Background(), "/guilds/"+testGuildID, nil, &guild); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed < test.want {
+				t.Errorf("retried after %s, want at least %s", elapsed, test.want)
+			}
+			if guild.Name != "Fan Server" {
+				t.Errorf("got guild %q after retrying", guild.Name)
+			}
+			if n := api.requests["/guilds/"+testGuildID]; n != 3 {
+				t.Errorf("sent %d requests, want 3", n)
+			}
+		})
+	}
+}
+
+func TestRateLimitGivesUp(t *testing.T) {
+	api, client := newTestAPI(t, 0)
+	api.retryAfterHeader = "0"
+	api.rateLimited["/guilds/"+testGuildID] = 1000
+
+	var guild apiGuild
+	err := client.get(context.Background(), "/guilds/"+testGuildID, nil, &guild)
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got error %v, want rate limit error", err)
+	}
+	if n := api.requests["/guilds/"+testGuildID]; n != maxRateLimitRetries+1 {
+		t.Errorf("sent %d requests, want %d", n, maxRateLimitRetries+1)
+	}
+}
+
+func TestFetchChannelConvertsBackup(t *testing.T) {
+	_, client := newTestAPI(t, 1)
+
+	backup, err := client.FetchChannel(context.Background(), testChannelID, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Guild{ID: testGuildID, Name: "Fan Server", IconURL: cdnBaseURL + "/icons/100/a_icon.gif?size=512"}); backup.Guild != want {
+		t.Errorf("got guild %+v, want %+v", backup.Guild, want)
+	}
+	if backup.Channel.ID != testChannelID || backup.Channel.Type != "GuildTextChat" || backup.Channel.Name != "battle-royale" ||
+		backup.Channel.Topic != "Topic" || backup.Channel.CategoryID != "199" || backup.Channel.Category != "Games" {
+		t.Errorf("got channel %+v", backup.Channel)
+	}
+	if len(backup.Messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(backup.Messages))
+	}
+
+	m := backup.Messages[0]
+	if m.ID != "1" || m.Type != "Default" || m.Content != "message 1" || !m.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC)) {
+		t.Errorf("got message %+v", m)
+	}
+	author := m.Author
+	if author.Name != "user" || author.GlobalName != "Global" || author.Nickname != "Guild Nick" || author.Discriminator != "0000" {
+		t.Errorf("got author names %q, %q, %q, %q", author.Name, author.GlobalName, author.Nickname, author.Discriminator)
+	}
+	roles := []string{}
+	for _, role := range author.Roles {
+		roles = append(roles, role.Name)
+	}
+	if want := []string{"Uncolored", "Moderator", "Member"}; !slices.Equal(roles, want) {
+		t.Errorf("got roles %v, want %v", roles, want)
+	}
+	if author.Color != "#FF0000" {
+		t.Errorf("got color %q, want color of the highest colored role", author.Color)
+	}
+
+	if len(m.Mentions) != 1 {
+		t.Fatalf("got %d mentions, want 1", len(m.Mentions))
+	}
+	left := m.Mentions[0]
+	if left.Name != "left" || left.Nickname != "left" || left.Discriminator != "1234" || left.AvatarURL != cdnBaseURL+"/embed/avatars/4.png" {
+		t.Errorf("got mention %+v", left)
+	}
+	if left.Roles != nil {
+		t.Errorf("got roles %v for a user without member, want none known", left.Roles)
+	}
+}
+
+func TestAvatarURL(t *testing.T) {
+	avatar := "a_hash"
+	for _, test := range []struct {
+		user apiUser
+		want string
+	}{
+		{apiUser{ID: "80351110224678912", Avatar: &avatar}, "/avatars/80351110224678912/a_hash.gif?size=512"},
+		// default avatars of migrated accounts go by their ID
+		{apiUser{ID: "80351110224678912", Discriminator: "0"}, "/embed/avatars/5.png"},
+		{apiUser{ID: "80351110224678912"}, "/embed/avatars/5.png"},
+		// and those of legacy accounts by their discriminator
+		{apiUser{ID: "80351110224678912", Discriminator: "1337"}, "/embed/avatars/2.png"},
+		{apiUser{ID: "80351110224678912", Discriminator: "0005"}, "/embed/avatars/0.png"},
+	} {
+		if got := avatarURL(test.user); got != cdnBaseURL+test.want {
+			t.Errorf("avatarURL(%+v) = %q, want %q", test.user, got, cdnBaseURL+test.want)
+		}
+	}
+}
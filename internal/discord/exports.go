@@ -0,0 +1,237 @@
+package discord
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ExportFile is a single message export document, either stored as a plain
+// file or inside a compressed file or archive.
+type ExportFile struct {
+	// Path is the file path of the export. For entries inside an archive this
+	// is the archive path joined with the entry name.
+	Path string
+
+	open func() (io.ReadCloser, error)
+}
+
+// Open returns a reader for the uncompressed JSON document.
+func (f ExportFile) Open() (io.ReadCloser, error) {
+	return f.open()
+}
+
+// IsExportFileName returns whether the file name looks like something
+// FindExportFiles can read exports from.
+func IsExportFileName(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".json", ".json.gz", ".json.zst", ".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindExportFiles returns all exports found in the given file or directory,
+// recursing into directories, zip and tar.gz archives. Plain JSON files may
+// also be compressed with gzip or zstd.
+func FindExportFiles(root string) ([]ExportFile, error) {
+	exportFiles := []ExportFile{}
+	walkFunc := func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !IsExportFileName(info.Name()) {
+			return nil
+		}
+		files, err := readExportFiles(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		exportFiles = append(exportFiles, files...)
+		return nil
+	}
+	if err := filepath.Walk(root, walkFunc); err != nil {
+		return nil, err
+	}
+	return exportFiles, nil
+}
+
+func readExportFiles(p string) ([]ExportFile, error) {
+	name := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return readZipExportFiles(p)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return readTarExportFiles(p)
+	}
+	return []ExportFile{{
+		Path: p,
+		open: func() (io.ReadCloser, error) {
+			f, err := os.Open(p)
+			if err != nil {
+				return nil, err
+			}
+			return decompress(p, f)
+		},
+	}}, nil
+}
+
+// decompress wraps r with a decompressor matching the file name. Closing the
+// returned reader also closes r.
+func decompress(name string, r io.ReadCloser) (io.ReadCloser, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return &wrappedReadCloser{Reader: gr, closers: []io.Closer{gr, r}}, nil
+	case strings.HasSuffix(name, ".zst"):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return &wrappedReadCloser{Reader: zr, closers: []io.Closer{zr.IOReadCloser(), r}}, nil
+	}
+	return r, nil
+}
+
+func readZipExportFiles(p string) ([]ExportFile, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	exportFiles := []ExportFile{}
+	for _, entry := range zr.File {
+		entryName := entry.Name
+		if entry.FileInfo().IsDir() || !isPlainExportFileName(entryName) {
+			continue
+		}
+		exportFiles = append(exportFiles, ExportFile{
+			Path: path.Join(filepath.ToSlash(p), entryName),
+			open: func() (io.ReadCloser, error) {
+				zr, err := zip.OpenReader(p)
+				if err != nil {
+					return nil, err
+				}
+				r, err := zr.Open(entryName)
+				if err != nil {
+					zr.Close()
+					return nil, err
+				}
+				return decompress(entryName, &wrappedReadCloser{Reader: r, closers: []io.Closer{r, zr}})
+			},
+		})
+	}
+	return exportFiles, nil
+}
+
+func readTarExportFiles(p string) ([]ExportFile, error) {
+	exportFiles := []ExportFile{}
+	err := walkTar(p, func(hdr *tar.Header, _ io.Reader) (bool, error) {
+		if hdr.Typeflag != tar.TypeReg || !isPlainExportFileName(hdr.Name) {
+			return false, nil
+		}
+		entryName := hdr.Name
+		exportFiles = append(exportFiles, ExportFile{
+			Path: path.Join(filepath.ToSlash(p), entryName),
+			open: func() (io.ReadCloser, error) {
+				// tar archives can not be seeked into so we have to read up to
+				// the entry again
+				pr, pw := io.Pipe()
+				go func() {
+					found := false
+					err := walkTar(p, func(hdr *tar.Header, r io.Reader) (bool, error) {
+						if hdr.Name != entryName {
+							return false, nil
+						}
+						found = true
+						_, err := io.Copy(pw, r)
+						return true, err
+					})
+					if err == nil && !found {
+						err = fmt.Errorf("entry %s disappeared from %s", entryName, p)
+					}
+					pw.CloseWithError(err)
+				}()
+				return decompress(entryName, pr)
+			},
+		})
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exportFiles, nil
+}
+
+// walkTar calls f for each entry of the gzipped tar archive until f returns
+// true or an error.
+func walkTar(p string, f func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stop, err := f(hdr, tr)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+}
+
+// isPlainExportFileName returns whether an archive entry is a (possibly
+// compressed) JSON export, archives nested in archives are not supported.
+func isPlainExportFileName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".json") ||
+		strings.HasSuffix(name, ".json.gz") ||
+		strings.HasSuffix(name, ".json.zst")
+}
+
+type wrappedReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (w *wrappedReadCloser) Close() error {
+	var errs []error
+	for _, c := range w.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,289 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DefaultGatewayURL = "wss://gateway.discord.gg/?v=10&encoding=json"
+
+	// IntentsGuildMessages subscribes to guild messages including their
+	// content, which is a privileged intent.
+	IntentsGuildMessages = 1<<0 | 1<<9 | 1<<15
+)
+
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatACK   = 11
+)
+
+// MessageEvent is a message that was created or updated in a channel.
+type MessageEvent struct {
+	// Type is either MESSAGE_CREATE or MESSAGE_UPDATE.
+	Type      string
+	ChannelID string
+	Message   Message
+}
+
+type gatewayPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d,omitempty"`
+	S  *int64          `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+type gatewaySession struct {
+	id        string
+	resumeURL string
+
+	// seq is also read by the heartbeat goroutine
+	seqLock sync.Mutex
+	seq     *int64
+}
+
+func (s *gatewaySession) lastSeq() *int64 {
+	s.seqLock.Lock()
+	defer s.seqLock.Unlock()
+	return s.seq
+}
+
+func (s *gatewaySession) setSeq(seq *int64) {
+	s.seqLock.Lock()
+	defer s.seqLock.Unlock()
+	s.seq = seq
+}
+
+// invalidate forgets the session so the next connection identifies anew.
+func (s *gatewaySession) invalidate() {
+	s.id = ""
+	s.resumeURL = ""
+	s.setSeq(nil)
+}
+
+// errGatewayFatal wraps errors that reconnecting will not fix, such as an
+// invalid token.
+type errGatewayFatal struct {
+	err error
+}
+
+func (e *errGatewayFatal) Error() string { return e.err.Error() }
+func (e *errGatewayFatal) Unwrap() error { return e.err }
+
+// Listen connects to the Discord gateway and calls handle for every message
+// created or updated in the given channels (or any channel visible to the
+// token if none are given) until ctx is done or handle returns an error. Lost
+// connections are resumed automatically.
+//
+// Update events only carry changed fields, so the full message is fetched via
+// the REST API before calling handle.
+func (c *Client) Listen(ctx context.Context, gatewayURL string, intents int, channelIDs []string, handle func(MessageEvent) error) error {
+	if len(gatewayURL) == 0 {
+		gatewayURL = DefaultGatewayURL
+	}
+	session := &gatewaySession{}
+	for {
+		err := c.listenOnce(ctx, gatewayURL, intents, channelIDs, session, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var fatal *errGatewayFatal
+		if errors.As(err, &fatal) {
+			return fatal.err
+		}
+		log.Printf("WARNING: Gateway connection lost, reconnecting: %s", err)
+		if err := sleep(ctx, 5*time.Second); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) listenOnce(ctx context.Context, gatewayURL string, intents int, channelIDs []string, session *gatewaySession, handle func(MessageEvent) error) error {
+	connectURL := gatewayURL
+	if len(session.id) > 0 && len(session.resumeURL) > 0 {
+		connectURL = session.resumeURL
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, connectURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// gorilla/websocket only supports a single concurrent writer
+	var writeLock sync.Mutex
+	send := func(op int, d any) error {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return conn.WriteJSON(gatewayPayload{Op: op, D: data})
+	}
+
+	// close the connection when we are asked to stop so reads return
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var hello gatewayPayload
+	if err := conn.ReadJSON(&hello); err != nil {
+		return err
+	}
+	if hello.Op != opHello {
+		return fmt.Errorf("expected hello from gateway, got op %d", hello.Op)
+	}
+	var helloData struct {
+		HeartbeatInterval int `json:"heartbeat_interval"`
+	}
+	if err := json.Unmarshal(hello.D, &helloData); err != nil {
+		return err
+	}
+
+	go func() {
+		interval := time.Duration(helloData.HeartbeatInterval) * time.Millisecond
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := send(opHeartbeat, session.lastSeq()); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	if len(session.id) > 0 {
+		err = send(opResume, map[string]any{
+			"token":      c.Token,
+			"session_id": session.id,
+			"seq":        session.lastSeq(),
+		})
+	} else {
+		err = send(opIdentify, map[string]any{
+			"token":   c.Token,
+			"intents": intents,
+			"properties": map[string]string{
+				"os":      "linux",
+				"browser": "hololive-bettel-royale-data-processing",
+				"device":  "hololive-bettel-royale-data-processing",
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		var payload gatewayPayload
+		if err := conn.ReadJSON(&payload); err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				switch closeErr.Code {
+				case 4004, 4010, 4011, 4012, 4013, 4014:
+					return &errGatewayFatal{err: err}
+				case 4007, 4009:
+					// session can not be resumed anymore
+					session.invalidate()
+				}
+			}
+			return err
+		}
+		switch payload.Op {
+		case opHeartbeat:
+			if err := send(opHeartbeat, session.lastSeq()); err != nil {
+				return err
+			}
+		case opHeartbeatACK:
+		case opReconnect:
+			return errors.New("gateway requested reconnect")
+		case opInvalidSession:
+			var resumable bool
+			_ = json.Unmarshal(payload.D, &resumable)
+			if !resumable {
+				session.invalidate()
+			}
+			return errors.New("gateway invalidated session")
+		case opDispatch:
+			// only advance the sequence once the event was handled so a
+			// resumed session replays it
+			if err := c.dispatch(ctx, session, channelIDs, payload, handle); err != nil {
+				return err
+			}
+			if payload.S != nil {
+				session.setSeq(payload.S)
+			}
+		}
+	}
+}
+
+func (c *Client) dispatch(ctx context.Context, session *gatewaySession, channelIDs []string, payload gatewayPayload, handle func(MessageEvent) error) error {
+	switch payload.T {
+	case "READY":
+		var ready struct {
+			SessionID        string `json:"session_id"`
+			ResumeGatewayURL string `json:"resume_gateway_url"`
+		}
+		if err := json.Unmarshal(payload.D, &ready); err != nil {
+			return err
+		}
+		session.id = ready.SessionID
+		session.resumeURL = ""
+		if len(ready.ResumeGatewayURL) > 0 {
+			u, err := url.Parse(ready.ResumeGatewayURL)
+			if err != nil {
+				return err
+			}
+			u.RawQuery = "v=10&encoding=json"
+			session.resumeURL = u.String()
+		}
+
+	case "MESSAGE_CREATE", "MESSAGE_UPDATE":
+		var m apiMessage
+		if err := json.Unmarshal(payload.D, &m); err != nil {
+			return err
+		}
+		if len(channelIDs) > 0 && !slices.Contains(channelIDs, m.ChannelID) {
+			return nil
+		}
+		var msg Message
+		var err error
+		if payload.T == "MESSAGE_UPDATE" {
+			msg, err = c.FetchMessage(ctx, m.GuildID, m.ChannelID, m.ID)
+		} else {
+			msg, err = c.convertMessage(ctx, m.GuildID, m)
+		}
+		if err != nil {
+			return err
+		}
+		if err := handle(MessageEvent{
+			Type:      payload.T,
+			ChannelID: m.ChannelID,
+			Message:   msg,
+		}); err != nil {
+			return &errGatewayFatal{err: err}
+		}
+	}
+	return nil
+}
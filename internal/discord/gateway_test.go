@@ -0,0 +1,187 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serveGateway is a stand-in for the Discord gateway that sends the test API's
+// dispatches once the client identified and then waits for it to disconnect.
+func (api *testAPI) serveGateway(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		api.t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(gatewayPayload{Op: opHello, D: json.RawMessage(`{"heartbeat_interval":45000}`)}); err != nil {
+		api.t.Error(err)
+		return
+	}
+	var identify gatewayPayload
+	if err := conn.ReadJSON(&identify); err != nil {
+		api.t.Error(err)
+		return
+	}
+	var identifyData struct {
+		Token   string `json:"token"`
+		Intents int    `json:"intents"`
+	}
+	if err := json.Unmarshal(identify.D, &identifyData); err != nil {
+		api.t.Error(err)
+		return
+	}
+	if identify.Op != opIdentify || identifyData.Token != "Bot token" || identifyData.Intents != IntentsGuildMessages {
+		api.t.Errorf("got op %d with %+v instead of identify", identify.Op, identifyData)
+		return
+	}
+
+	for i, payload := range append([]gatewayPayload{{
+		T: "READY",
+		D: json.RawMessage(`{"session_id":"session","resume_gateway_url":"ws://localhost/resume"}`),
+	}}, api.dispatches...) {
+		seq := int64(i + 1)
+		payload.Op = opDispatch
+		payload.S = &seq
+		if err := conn.WriteJSON(payload); err != nil {
+			api.t.Error(err)
+			return
+		}
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func testDispatch(t *testing.T, event string, v any) gatewayPayload {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gatewayPayload{T: event, D: data}
+}
+
+func TestListenDeliversMessageEvents(t *testing.T) {
+	api, client := newTestAPI(t, 0)
+	created := testMessage(5)
+	created.GuildID = testGuildID
+	otherChannel := testMessage(6)
+	otherChannel.ChannelID = "999"
+	api.dispatches = []gatewayPayload{
+		testDispatch(t, "MESSAGE_CREATE", created),
+		testDispatch(t, "MESSAGE_CREATE", otherChannel),
+		testDispatch(t, "TYPING_START", map[string]string{"channel_id": testChannelID}),
+		// updates only carry what changed
+		testDispatch(t, "MESSAGE_UPDATE", map[string]string{"id": "7", "channel_id": testChannelID, "guild_id": testGuildID}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := []MessageEvent{}
+	gatewayURL := "ws" + strings.TrimPrefix(client.BaseURL, "http") + "/gateway"
+	err := client.Listen(ctx, gatewayURL, IntentsGuildMessages, []string{testChannelID}, func(ev MessageEvent) error {
+		events = append(events, ev)
+		if len(events) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want listening to be canceled", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	for i, want := range []struct {
+		Type, ID, Content string
+	}{
+		{"MESSAGE_CREATE", "5", "message 5"},
+		// the full message is fetched for updates
+		{"MESSAGE_UPDATE", "7", "edited message 7"},
+	} {
+		ev := events[i]
+		if ev.Type != want.Type || ev.ChannelID != testChannelID || ev.Message.ID != want.ID || ev.Message.Content != want.Content {
+			t.Errorf("got event %s in channel %s with message %s %q, want %s with message %s %q",
+				ev.Type, ev.ChannelID, ev.Message.ID, ev.Message.Content, want.Type, want.ID, want.Content)
+		}
+		if ev.Message.Author.Nickname != "Guild Nick" {
+			t.Errorf("got author nickname %q, want the guild nickname", ev.Message.Author.Nickname)
+		}
+	}
+}
+
+func TestListenFetchesEditedMessages(t *testing.T) {
+	api, client := newTestAPI(t, 0)
+	// edits of other channels are neither fetched nor delivered
+	otherChannel := testMessage(8)
+	otherChannel.ChannelID = "999"
+	edited := testMessage(7)
+	editedAt := edited.Timestamp.Add(time.Minute)
+	edited.EditedTimestamp = &editedAt
+	edited.Content = "partially edited message 7"
+	api.dispatches = []gatewayPayload{
+		testDispatch(t, "MESSAGE_UPDATE", otherChannel),
+		testDispatch(t, "MESSAGE_UPDATE", edited),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := []MessageEvent{}
+	gatewayURL := "ws" + strings.TrimPrefix(client.BaseURL, "http") + "/gateway"
+	err := client.Listen(ctx, gatewayURL, IntentsGuildMessages, []string{testChannelID}, func(ev MessageEvent) error {
+		events = append(events, ev)
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want listening to be canceled", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1: %+v", len(events), events)
+	}
+	ev := events[0]
+	// the fetched version wins over whatever the update carried
+	if ev.Type != "MESSAGE_UPDATE" || ev.Message.ID != "7" || ev.Message.Content != "edited message 7" {
+		t.Errorf("got event %s with message %s %q, want the edited message 7", ev.Type, ev.Message.ID, ev.Message.Content)
+	}
+	wantEdited := edited.Timestamp.Add(time.Hour)
+	if ev.Message.TimestampEdited == nil || !ev.Message.TimestampEdited.Equal(wantEdited) {
+		t.Errorf("got edit time %v, want %v", ev.Message.TimestampEdited, wantEdited)
+	}
+	if n := api.requests["/channels/999/messages/8"]; n != 0 {
+		t.Errorf("fetched the edit of another channel %d times", n)
+	}
+}
+
+func TestListenStopsOnHandlerError(t *testing.T) {
+	api, client := newTestAPI(t, 0)
+	created := testMessage(5)
+	created.GuildID = testGuildID
+	api.dispatches = []gatewayPayload{
+		testDispatch(t, "MESSAGE_CREATE", created),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errHandler := errors.New("handler failed")
+	gatewayURL := "ws" + strings.TrimPrefix(client.BaseURL, "http") + "/gateway"
+	err := client.Listen(ctx, gatewayURL, IntentsGuildMessages, nil, func(ev MessageEvent) error {
+		return errHandler
+	})
+	if !errors.Is(err, errHandler) {
+		t.Fatalf("got error %v, want the handler's error", err)
+	}
+}
@@ -47,6 +47,10 @@ type Author struct {
 	IsBot         bool   `json:"isBot"`
 	Roles         []Role `json:"roles"`
 	AvatarURL     string `json:"avatarUrl"`
+
+	// GlobalName is only known for messages fetched via the API, Nickname
+	// then is the guild nickname if it differs.
+	GlobalName string `json:"globalName,omitempty"`
 }
 
 type Thumbnail struct {
@@ -100,6 +104,10 @@ type User struct {
 	IsBot         bool   `json:"isBot"`
 	Roles         []Role `json:"roles"`
 	AvatarURL     string `json:"avatarUrl"`
+
+	// GlobalName is only known for messages fetched via the API, Nickname
+	// then is the guild nickname if it differs.
+	GlobalName string `json:"globalName,omitempty"`
 }
 
 type Interaction struct {
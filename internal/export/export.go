@@ -0,0 +1,232 @@
+// Package export writes tables as CSV, JSON Lines or Parquet files for use
+// outside of SQL, e.g. with pandas, R or spreadsheets.
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported formats.
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Extension returns the file extension for the format.
+func Extension(format string) string {
+	return "." + format
+}
+
+// Writer writes the rows of a single relation.
+type Writer interface {
+	// WriteRow writes a row with values as returned by
+	// database.Database.ReadRelation.
+	WriteRow(row []any) error
+	// Close flushes everything that is still buffered.
+	Close() error
+}
+
+// NewWriter returns a writer for rows of the relation in the given format.
+func NewWriter(format string, w io.Writer, relation database.Relation) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, relation)
+	case FormatJSONL:
+		return &jsonlWriter{w: bufio.NewWriter(w), relation: relation}, nil
+	case FormatParquet:
+		return newParquetWriter(w, relation), nil
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// formatTime formats times the same way for all formats.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// csvWriter writes a header with the column names followed by one line per
+// row. CSV has no null, so null values are written as empty fields.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, relation database.Relation) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	header := []string{}
+	for _, column := range relation.Columns {
+		header = append(header, column.Name)
+	}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) WriteRow(row []any) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			record[i] = v
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		case time.Time:
+			record[i] = formatTime(v)
+		default:
+			return fmt.Errorf("unsupported value type %T", value)
+		}
+	}
+	return w.w.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// jsonlWriter writes one JSON object per row with keys in column order.
+type jsonlWriter struct {
+	w        *bufio.Writer
+	relation database.Relation
+}
+
+func (w *jsonlWriter) WriteRow(row []any) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, value := range row {
+		if t, ok := value.(time.Time); ok {
+			value = formatTime(t)
+		}
+		key, err := json.Marshal(w.relation.Columns[i].Name)
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(encoded)
+	}
+	buf.WriteString("}\n")
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.w.Flush()
+}
+
+// parquetWriter writes rows with a schema matching the column types, times
+// are stored as UTC timestamps in microseconds.
+type parquetWriter struct {
+	w *parquet.Writer
+	// leaves are the schema's leaf columns in the order of the relation's
+	// columns, the schema orders them by name.
+	leaves []parquet.LeafColumn
+	buf    []parquet.Row
+}
+
+func newParquetWriter(w io.Writer, relation database.Relation) *parquetWriter {
+	group := parquet.Group{}
+	for _, column := range relation.Columns {
+		var node parquet.Node
+		switch column.Type {
+		case database.ColumnTypeInteger:
+			node = parquet.Int(64)
+		case database.ColumnTypeFloat:
+			node = parquet.Leaf(parquet.DoubleType)
+		case database.ColumnTypeBoolean:
+			node = parquet.Leaf(parquet.BooleanType)
+		case database.ColumnTypeTimestamp:
+			node = parquet.Timestamp(parquet.Microsecond)
+		default:
+			node = parquet.String()
+		}
+		if column.Nullable {
+			node = parquet.Optional(node)
+		}
+		group[column.Name] = node
+	}
+	schema := parquet.NewSchema(relation.Name, group)
+
+	pw := &parquetWriter{
+		w: parquet.NewWriter(w, schema, parquet.Compression(&parquet.Zstd)),
+	}
+	for _, column := range relation.Columns {
+		leaf, _ := schema.Lookup(column.Name)
+		pw.leaves = append(pw.leaves, leaf)
+	}
+	return pw
+}
+
+func (w *parquetWriter) WriteRow(row []any) error {
+	values := make(parquet.Row, len(row))
+	for i, value := range row {
+		var v parquet.Value
+		switch value := value.(type) {
+		case nil:
+			v = parquet.NullValue()
+		case string:
+			v = parquet.ByteArrayValue([]byte(value))
+		case int64:
+			v = parquet.Int64Value(value)
+		case float64:
+			v = parquet.DoubleValue(value)
+		case bool:
+			v = parquet.BooleanValue(value)
+		case time.Time:
+			v = parquet.Int64Value(value.UnixMicro())
+		default:
+			return fmt.Errorf("unsupported value type %T", value)
+		}
+		// the definition level tells nulls apart from values of optional
+		// columns, required columns always have a level of zero
+		leaf := w.leaves[i]
+		definitionLevel := leaf.MaxDefinitionLevel
+		if value == nil {
+			definitionLevel = 0
+		}
+		values[leaf.ColumnIndex] = v.Level(0, definitionLevel, leaf.ColumnIndex)
+	}
+	w.buf = append(w.buf, values)
+	if len(w.buf) >= 1000 {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) flush() error {
+	if _, err := w.w.WriteRows(w.buf); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,165 @@
+// Package markdown tokenizes the subset of Discord markdown the battle royale
+// bot uses to format its messages, i.e. bold, strikethrough and underlined
+// spans as well as backslash escapes.
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a token or span.
+type Kind int
+
+const (
+	Text Kind = iota
+	Bold
+	Strikethrough
+	Underline
+)
+
+var delimiters = map[string]Kind{
+	"**": Bold,
+	"~~": Strikethrough,
+	"__": Underline,
+}
+
+// Token is either a piece of text or a formatting delimiter.
+type Token struct {
+	Kind Kind
+	// Start and End are the byte offsets of the token in the source.
+	Start, End int
+	// Text is the unescaped text, for delimiters it is the delimiter itself.
+	Text string
+}
+
+// isEscapable returns whether a backslash in front of r is an escape. Like in
+// Discord's markdown parser any symbol can be escaped, letters, digits and
+// whitespace can not.
+func isEscapable(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// Tokenize splits s into text and delimiter tokens.
+func Tokenize(s string) []Token {
+	tokens := []Token{}
+	var text strings.Builder
+	textStart := 0
+	flush := func(end int) {
+		if end > textStart {
+			tokens = append(tokens, Token{Kind: Text, Start: textStart, End: end, Text: text.String()})
+		}
+		text.Reset()
+	}
+	for i := 0; i < len(s); {
+		if s[i] == '\\' {
+			if r, size := utf8.DecodeRuneInString(s[i+1:]); size > 0 && isEscapable(r) {
+				text.WriteRune(r)
+				i += 1 + size
+				continue
+			}
+		}
+		if i+2 <= len(s) {
+			if kind, ok := delimiters[s[i:i+2]]; ok {
+				flush(i)
+				tokens = append(tokens, Token{Kind: kind, Start: i, End: i + 2, Text: s[i : i+2]})
+				i += 2
+				textStart = i
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteRune(r)
+		i += size
+	}
+	flush(len(s))
+	return tokens
+}
+
+// Span is a formatted part of the source.
+type Span struct {
+	Kind Kind
+	// Start and End are the byte offsets of the span in the source including
+	// its delimiters.
+	Start, End int
+	// Text is the unescaped text within the span without any formatting.
+	Text string
+}
+
+// Spans returns all formatted spans of s ordered by their start. Spans can
+// be nested, e.g. a bold span within a strikethrough span. Delimiters without
+// a match are treated as text.
+func Spans(s string) []Span {
+	tokens := Tokenize(s)
+
+	// match delimiters, closing the innermost open delimiter of the same kind
+	// and dropping any unmatched ones opened after it
+	matched := make([]int, len(tokens))
+	for i := range matched {
+		matched[i] = -1
+	}
+	open := []int{}
+	for i, token := range tokens {
+		if token.Kind == Text {
+			continue
+		}
+		j := len(open) - 1
+		for j >= 0 && tokens[open[j]].Kind != token.Kind {
+			j--
+		}
+		if j < 0 {
+			open = append(open, i)
+			continue
+		}
+		matched[open[j]] = i
+		matched[i] = open[j]
+		open = open[:j]
+	}
+
+	spans := []Span{}
+	for i, token := range tokens {
+		if token.Kind == Text || matched[i] < i {
+			continue
+		}
+		var text strings.Builder
+		for j := i + 1; j < matched[i]; j++ {
+			if tokens[j].Kind == Text || matched[j] < 0 {
+				text.WriteString(tokens[j].Text)
+			}
+		}
+		spans = append(spans, Span{
+			Kind:  token.Kind,
+			Start: token.Start,
+			End:   tokens[matched[i]].End,
+			Text:  text.String(),
+		})
+	}
+	return spans
+}
+
+// Unescape removes backslash escapes from s but keeps any formatting.
+func Unescape(s string) string {
+	var text strings.Builder
+	for _, token := range Tokenize(s) {
+		text.WriteString(token.Text)
+	}
+	return text.String()
+}
+
+// escaped are the characters the bot is known to escape in names, the
+// delimiters and backslash as well as periods.
+const escaped = "\\*_~`|."
+
+// Escape escapes s the way the bot escapes names, so that it reads as plain
+// text within formatting.
+func Escape(s string) string {
+	var text strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(escaped, r) {
+			text.WriteByte('\\')
+		}
+		text.WriteRune(r)
+	}
+	return text.String()
+}
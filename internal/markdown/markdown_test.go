@@ -0,0 +1,103 @@
+package markdown
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnescape(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		// every symbol can be escaped, including the ones the bot never
+		// escapes
+		{`\*\_\~\` + "`" + `\|\.\\`, "*_~`|.\\"},
+		{`\#\>\-\[\]\(\)\:\<\@\!`, `#>-[]():<@!`},
+		// letters, digits and whitespace can not
+		{`\a\1\ b\	c`, `\a\1\ b\	c`},
+		// neither can the end of the string
+		{`name\`, `name\`},
+		{`\\\`, `\\`},
+		{`\ä\名`, `\ä\名`},
+		{`\—`, `—`},
+		// formatting is kept
+		{`**a\_b**`, `**a_b**`},
+	} {
+		if got := Unescape(test.in); got != test.want {
+			t.Errorf("Unescape(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []Span
+	}{
+		{"plain", []Span{}},
+		{"**bold**", []Span{{Bold, 0, 8, "bold"}}},
+		{"~~**x**~~", []Span{
+			{Strikethrough, 0, 9, "x"},
+			{Bold, 2, 7, "x"},
+		}},
+		{"__**x**__", []Span{
+			{Underline, 0, 9, "x"},
+			{Bold, 2, 7, "x"},
+		}},
+		// italics are not supported, the third asterisk is text
+		{"***x***", []Span{{Bold, 0, 6, "*x"}}},
+		{"**Name#1234**", []Span{{Bold, 0, 13, "Name#1234"}}},
+		{"**Some Name** and ~~Other Name~~", []Span{
+			{Bold, 0, 13, "Some Name"},
+			{Strikethrough, 18, 32, "Other Name"},
+		}},
+		{"**Ünïcödé Nämé 名前**", []Span{{Bold, 0, 29, "Ünïcödé Nämé 名前"}}},
+		// unmatched delimiters are text
+		{"**a", []Span{}},
+		{"a~~", []Span{}},
+		{"**a ~~b**", []Span{{Bold, 0, 9, "a ~~b"}}},
+		{"~~a** b~~", []Span{{Strikethrough, 0, 9, "a** b"}}},
+		{"**a** b**", []Span{{Bold, 0, 5, "a"}}},
+		// escaped delimiters are text, too
+		{`**a\**b**`, []Span{{Bold, 0, 9, "a**b"}}},
+		{`\**a**`, []Span{}},
+		{`\***a**`, []Span{{Bold, 2, 7, "a"}}},
+		{`~~\~~~`, []Span{{Strikethrough, 0, 6, "~"}}},
+	} {
+		if got := Spans(test.in); !slices.Equal(got, test.want) {
+			t.Errorf("Spans(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestEscapeRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"plain",
+		"Name#1234",
+		"with spaces",
+		"Ünïcödé 名前",
+		"**bold**",
+		"~~struck~~",
+		"__under__",
+		"***",
+		"a_b_c",
+		`back\slash`,
+		`trailing\`,
+		"`code`",
+		"||spoiler||",
+		"dot.name.",
+		`\*mixed_~|.`,
+	} {
+		escaped := Escape(name)
+		if got := Unescape(escaped); got != name {
+			t.Errorf("Unescape(Escape(%q)) = %q", name, got)
+		}
+		for _, kind := range []string{"**", "~~", "__"} {
+			s := kind + escaped + kind
+			want := []Span{{delimiters[kind], 0, len(s), name}}
+			if got := Spans(s); !slices.Equal(got, want) {
+				t.Errorf("Spans(%q) = %+v, want %+v", s, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package optout reads and writes the list of users who asked to be removed
+// from the data. Their accounts are replaced by pseudonyms on import so game
+// statistics stay the same without revealing who took part.
+package optout
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// header is written at the top of the file since comments are lost when
+// decoding it.
+const header = `# Users who asked to be removed from the data. Everything they did is kept
+# under a pseudonym so game statistics stay the same, names and any other
+# details of the account are dropped.
+#
+# This file is maintained by the forget subcommand. Users are only listed by a
+# hash of their ID keyed with OPT_OUT_KEY, which needs to stay the same and
+# must never be published.
+`
+
+// pseudonymPrefix starts every pseudonym.
+const pseudonymPrefix = "forgotten-"
+
+// rxHash matches the hashes users are listed by.
+var rxHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Key derives the hashes users are listed by and their pseudonyms from their
+// IDs. Without it neither can be traced back to the user.
+type Key []byte
+
+func (k Key) sum(kind, userID string) []byte {
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userID))
+	return mac.Sum(nil)
+}
+
+// Hash returns what the user is listed by.
+func (k Key) Hash(userID string) string {
+	return hex.EncodeToString(k.sum("opt-out", userID))
+}
+
+// Pseudonym returns the ID and name the user is replaced with. It is derived
+// separately from the hash so entries of the file can not be matched to
+// pseudonyms either.
+func (k Key) Pseudonym(userID string) string {
+	return pseudonymPrefix + hex.EncodeToString(k.sum("pseudonym", userID)[:6])
+}
+
+// IsPseudonym returns whether the user ID is the pseudonym of a forgotten
+// user.
+func IsPseudonym(userID string) bool {
+	return strings.HasPrefix(userID, pseudonymPrefix)
+}
+
+// Entry is a user who opted out.
+type Entry struct {
+	Hash string `yaml:"hash,omitempty"`
+	// UserID is only set by files written before users were listed by hash,
+	// it is replaced by the hash when saving.
+	UserID string `yaml:"user_id,omitempty"`
+	Note   string `yaml:"note,omitempty"`
+}
+
+// File is the opt-out file format.
+type File struct {
+	Users []Entry `yaml:"users"`
+}
+
+// Load reads and validates the opt-out file at the given path. A missing file
+// is the same as an empty one.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{Users: []Entry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opt-out file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Read parses and validates an opt-out file.
+func Read(r io.Reader) (*File, error) {
+	file := &File{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if file.Users == nil {
+		file.Users = []Entry{}
+	}
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Save replaces user IDs left by older files with their hash, validates the
+// file and writes it to the given path.
+func (f *File) Save(path string, key Key) error {
+	for i, entry := range f.Users {
+		if len(entry.UserID) > 0 {
+			f.Users[i].Hash = key.Hash(entry.UserID)
+			f.Users[i].UserID = ""
+		}
+	}
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	// write to a temporary file first so an interrupted write never leaves a
+	// broken file behind
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Validate checks that every entry has either a valid hash or a user ID and
+// no user is listed twice.
+func (f *File) Validate() error {
+	errs := []error{}
+	for i, entry := range f.Users {
+		switch {
+		case len(entry.Hash) > 0 && len(entry.UserID) > 0:
+			errs = append(errs, fmt.Errorf("entry #%d: both hash and user_id given", i+1))
+			continue
+		case len(entry.Hash) > 0 && !rxHash.MatchString(entry.Hash):
+			errs = append(errs, fmt.Errorf("entry #%d: invalid hash %q", i+1, entry.Hash))
+			continue
+		case len(entry.Hash) == 0 && len(entry.UserID) == 0:
+			errs = append(errs, fmt.Errorf("entry #%d: missing hash", i+1))
+			continue
+		}
+		if j := slices.IndexFunc(f.Users[:i], func(e Entry) bool {
+			return e.Hash == entry.Hash && e.UserID == entry.UserID
+		}); j >= 0 {
+			errs = append(errs, fmt.Errorf("entry #%d duplicates entry #%d", i+1, j+1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HasUserIDs returns whether any user is still listed by ID rather than hash.
+func (f *File) HasUserIDs() bool {
+	return slices.ContainsFunc(f.Users, func(e Entry) bool {
+		return len(e.UserID) > 0
+	})
+}
+
+// Hashes returns the hash of every listed user.
+func (f *File) Hashes(key Key) map[string]bool {
+	hashes := map[string]bool{}
+	for _, entry := range f.Users {
+		if len(entry.UserID) > 0 {
+			hashes[key.Hash(entry.UserID)] = true
+		} else {
+			hashes[entry.Hash] = true
+		}
+	}
+	return hashes
+}
+
+// Add appends the user unless already listed and returns whether it was
+// added.
+func (f *File) Add(key Key, userID, note string) bool {
+	hash := key.Hash(userID)
+	if f.Hashes(key)[hash] {
+		return false
+	}
+	f.Users = append(f.Users, Entry{Hash: hash, Note: note})
+	return true
+}
@@ -0,0 +1,193 @@
+// Package players reads and writes the hand-maintained file that groups
+// several Discord accounts of the same person into a single player, e.g. after
+// someone moved to a new account.
+package players
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the current version of the file format. Files of older versions
+// are still read, newer ones are rejected.
+const Version = 1
+
+// header is written at the top of the file since comments are lost when
+// decoding it.
+const header = `# Discord accounts that belong to the same player, e.g. because someone moved
+# to a new account. Accounts not listed here are players of their own.
+#
+# This file is maintained by the link-accounts and unlink-accounts
+# subcommands, manual changes are fine but comments will be lost.
+`
+
+// Player is a person using one or more Discord accounts.
+type Player struct {
+	Name string `yaml:"name"`
+	// Accounts are the Discord user IDs of the player.
+	Accounts []string `yaml:"accounts"`
+	Note     string   `yaml:"note,omitempty"`
+}
+
+// File is the player mapping file format.
+type File struct {
+	Version int      `yaml:"version"`
+	Players []Player `yaml:"players"`
+}
+
+// Load reads and validates the player file at the given path. A missing file
+// is the same as an empty one.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{Version: Version, Players: []Player{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid player file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Read parses and validates a player file.
+func Read(r io.Reader) (*File, error) {
+	file := &File{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	switch {
+	case file.Version == 0:
+		return nil, errors.New("missing version")
+	case file.Version > Version:
+		return nil, fmt.Errorf("unsupported version %d, at most %d is supported", file.Version, Version)
+	}
+	if file.Players == nil {
+		file.Players = []Player{}
+	}
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Save validates the file and writes it to the given path in the current
+// version.
+func (f *File) Save(path string) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	f.Version = Version
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	// write to a temporary file first so an interrupted write never leaves a
+	// broken file behind
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Validate checks that every player has a unique name and that no account
+// belongs to two players.
+func (f *File) Validate() error {
+	errs := []error{}
+	owners := map[string]string{}
+	for i, player := range f.Players {
+		switch {
+		case len(player.Name) == 0:
+			errs = append(errs, fmt.Errorf("player #%d: missing name", i+1))
+		case len(player.Accounts) == 0:
+			errs = append(errs, fmt.Errorf("player #%d (%s): no accounts", i+1, player.Name))
+		}
+		for j, other := range f.Players[:i] {
+			if len(player.Name) > 0 && player.Name == other.Name {
+				errs = append(errs, fmt.Errorf("player #%d (%s) has the same name as player #%d", i+1, player.Name, j+1))
+			}
+		}
+		for _, account := range player.Accounts {
+			if owner, ok := owners[account]; ok {
+				errs = append(errs, fmt.Errorf("player #%d (%s): account %s already belongs to player %s", i+1, player.Name, account, owner))
+				continue
+			}
+			owners[account] = player.Name
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PlayerOf returns the player the account belongs to or nil.
+func (f *File) PlayerOf(account string) *Player {
+	for i, player := range f.Players {
+		if slices.Contains(player.Accounts, account) {
+			return &f.Players[i]
+		}
+	}
+	return nil
+}
+
+// Link adds the accounts to the player with the given name, creating the
+// player if needed. Accounts that already belong to another player have to be
+// unlinked first.
+func (f *File) Link(name string, accounts ...string) error {
+	if len(name) == 0 {
+		return errors.New("missing player name")
+	}
+	for _, account := range accounts {
+		if owner := f.PlayerOf(account); owner != nil && owner.Name != name {
+			return fmt.Errorf("account %s already belongs to player %s", account, owner.Name)
+		}
+	}
+	index := slices.IndexFunc(f.Players, func(p Player) bool {
+		return p.Name == name
+	})
+	if index < 0 {
+		index = len(f.Players)
+		f.Players = append(f.Players, Player{Name: name})
+	}
+	for _, account := range accounts {
+		if !slices.Contains(f.Players[index].Accounts, account) {
+			f.Players[index].Accounts = append(f.Players[index].Accounts, account)
+		}
+	}
+	return f.Validate()
+}
+
+// Unlink removes the accounts from their players, players without any
+// accounts left are removed as well.
+func (f *File) Unlink(accounts ...string) error {
+	for _, account := range accounts {
+		owner := f.PlayerOf(account)
+		if owner == nil {
+			return fmt.Errorf("account %s does not belong to any player", account)
+		}
+		owner.Accounts = slices.DeleteFunc(owner.Accounts, func(a string) bool {
+			return a == account
+		})
+	}
+	f.Players = slices.DeleteFunc(f.Players, func(p Player) bool {
+		return len(p.Accounts) == 0
+	})
+	return nil
+}
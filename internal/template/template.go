@@ -0,0 +1,129 @@
+// Package template splits interaction templates into the slots filled by
+// mentioned users and items, and renders them back into the lines they were
+// parsed from.
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/markdown"
+)
+
+// ItemPlaceholder stands in for the mentioned item.
+const ItemPlaceholder = "{{item}}"
+
+// UserPlaceholder returns what stands in for the n-th distinct user of a line.
+func UserPlaceholder(n int) string {
+	return fmt.Sprintf("{{users[%d]}}", n)
+}
+
+var rxPlaceholder = regexp.MustCompile(`\{\{(?:users\[(\d+)\]|item)\}\}`)
+
+// Slots returns the slots of the message's template in the order their
+// placeholders first appear in. Events have a single slot for all users
+// listed below their description instead.
+func Slots(message database.InteractionMessage) []database.TemplateSlot {
+	if len(message.Event) > 0 {
+		return []database.TemplateSlot{{
+			MessageID: message.ID,
+			SlotIndex: 0,
+			Kind:      database.SlotKindUser,
+			Role:      database.SlotRoleListed,
+		}}
+	}
+
+	slots := []database.TemplateSlot{}
+	seen := map[string]bool{}
+	for _, match := range rxPlaceholder.FindAllStringSubmatch(message.Text, -1) {
+		if seen[match[0]] {
+			continue
+		}
+		seen[match[0]] = true
+		slot := database.TemplateSlot{
+			MessageID:   message.ID,
+			SlotIndex:   len(slots),
+			Kind:        database.SlotKindUser,
+			Role:        database.SlotRoleTarget,
+			Placeholder: match[0],
+		}
+		switch {
+		case match[0] == ItemPlaceholder:
+			slot.Kind = database.SlotKindItem
+			slot.Role = ""
+		case match[1] == "0":
+			slot.Role = database.SlotRoleActor
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// SlotIndex returns the index of the slot with the given placeholder.
+func SlotIndex(slots []database.TemplateSlot, placeholder string) (int, bool) {
+	for _, slot := range slots {
+		if slot.Placeholder == placeholder {
+			return slot.SlotIndex, true
+		}
+	}
+	return 0, false
+}
+
+// RenderUser formats a user mention the way the bot does, struck through if
+// the user was killed.
+func RenderUser(mention database.InteractionUserMention) string {
+	s := "**" + markdown.Escape(mention.UserName+mention.Suffix) + "**"
+	if mention.Killed {
+		s = "~~" + s + "~~"
+	}
+	return s
+}
+
+// RenderItem formats an item mention the way the bot does.
+func RenderItem(item database.Item) string {
+	return "__" + markdown.Escape(item.Name) + "__"
+}
+
+// Render rebuilds the line an interaction was parsed from by filling every
+// slot of its template with the user mentioned for it or the item. Users
+// listed below an event are not part of its text and left out.
+func Render(message database.InteractionMessage, slots []database.TemplateSlot, mentions []database.InteractionUserMention, items []database.Item) (string, error) {
+	bySlot := map[int][]database.InteractionUserMention{}
+	for _, mention := range mentions {
+		if mention.SlotIndex == nil {
+			return "", fmt.Errorf("mention of %s fills no slot", mention.UserName)
+		}
+		if !slices.ContainsFunc(slots, func(slot database.TemplateSlot) bool {
+			return slot.SlotIndex == *mention.SlotIndex && slot.Kind == database.SlotKindUser
+		}) {
+			return "", fmt.Errorf("mention of %s fills unknown slot %d", mention.UserName, *mention.SlotIndex)
+		}
+		bySlot[*mention.SlotIndex] = append(bySlot[*mention.SlotIndex], mention)
+	}
+
+	replacements := []string{}
+	for _, slot := range slots {
+		if len(slot.Placeholder) == 0 {
+			continue
+		}
+		switch slot.Kind {
+		case database.SlotKindUser:
+			if len(bySlot[slot.SlotIndex]) != 1 {
+				return "", fmt.Errorf("expected a single user for slot %d, got %d", slot.SlotIndex, len(bySlot[slot.SlotIndex]))
+			}
+			replacements = append(replacements, slot.Placeholder, RenderUser(bySlot[slot.SlotIndex][0]))
+		case database.SlotKindItem:
+			if len(items) != 1 {
+				return "", fmt.Errorf("expected a single item for slot %d, got %d", slot.SlotIndex, len(items))
+			}
+			replacements = append(replacements, slot.Placeholder, RenderItem(items[0]))
+		default:
+			return "", fmt.Errorf("can not fill %s slot %d", slot.Kind, slot.SlotIndex)
+		}
+	}
+	// replacing in a single pass keeps placeholders within names intact
+	return strings.NewReplacer(replacements...).Replace(message.Text), nil
+}
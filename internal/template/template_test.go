@@ -0,0 +1,156 @@
+package template
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/icedream/hololive-bettel-royale-data-processing/internal/database"
+)
+
+func slot(n int) *int {
+	return &n
+}
+
+func TestSlots(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		message database.InteractionMessage
+		want    []database.TemplateSlot
+	}{
+		{
+			name:    "users and item",
+			message: database.InteractionMessage{ID: 1, Text: "{{users[0]}} hit {{users[1]}} with {{item}}."},
+			want: []database.TemplateSlot{
+				{MessageID: 1, SlotIndex: 0, Kind: database.SlotKindUser, Role: database.SlotRoleActor, Placeholder: "{{users[0]}}"},
+				{MessageID: 1, SlotIndex: 1, Kind: database.SlotKindUser, Role: database.SlotRoleTarget, Placeholder: "{{users[1]}}"},
+				{MessageID: 1, SlotIndex: 2, Kind: database.SlotKindItem, Placeholder: "{{item}}"},
+			},
+		},
+		{
+			name:    "repeated user",
+			message: database.InteractionMessage{ID: 2, Text: "{{users[0]}} found {{item}}, {{users[0]}} is happy."},
+			want: []database.TemplateSlot{
+				{MessageID: 2, SlotIndex: 0, Kind: database.SlotKindUser, Role: database.SlotRoleActor, Placeholder: "{{users[0]}}"},
+				{MessageID: 2, SlotIndex: 1, Kind: database.SlotKindItem, Placeholder: "{{item}}"},
+			},
+		},
+		{
+			name:    "numbered by first appearance",
+			message: database.InteractionMessage{ID: 3, Text: "{{item}} fell on {{users[1]}} and {{users[0]}}."},
+			want: []database.TemplateSlot{
+				{MessageID: 3, SlotIndex: 0, Kind: database.SlotKindItem, Placeholder: "{{item}}"},
+				{MessageID: 3, SlotIndex: 1, Kind: database.SlotKindUser, Role: database.SlotRoleTarget, Placeholder: "{{users[1]}}"},
+				{MessageID: 3, SlotIndex: 2, Kind: database.SlotKindUser, Role: database.SlotRoleActor, Placeholder: "{{users[0]}}"},
+			},
+		},
+		{
+			name:    "no placeholders",
+			message: database.InteractionMessage{ID: 4, Text: "Nothing happened."},
+			want:    []database.TemplateSlot{},
+		},
+		{
+			name:    "event",
+			message: database.InteractionMessage{ID: 5, Text: "A storm passed, {{users[0]}}", Event: "STORM"},
+			want: []database.TemplateSlot{
+				{MessageID: 5, SlotIndex: 0, Kind: database.SlotKindUser, Role: database.SlotRoleListed},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Slots(test.message); !slices.Equal(got, test.want) {
+				t.Errorf("got slots %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	message := database.InteractionMessage{ID: 1, Text: "{{users[0]}} hit {{users[1]}} with {{item}}, {{users[0]}} laughs."}
+	slots := Slots(message)
+	for _, test := range []struct {
+		name     string
+		mentions []database.InteractionUserMention
+		items    []database.Item
+		want     string
+	}{
+		{
+			name: "users and item",
+			mentions: []database.InteractionUserMention{
+				{UserName: "alice", SlotIndex: slot(0)},
+				{UserName: "bob", Killed: true, SlotIndex: slot(1)},
+			},
+			items: []database.Item{{Name: "Frying Pan"}},
+			want:  "**alice** hit ~~**bob**~~ with __Frying Pan__, **alice** laughs.",
+		},
+		{
+			name: "placeholders inside names",
+			mentions: []database.InteractionUserMention{
+				{UserName: "{{users[1]}}", SlotIndex: slot(0)},
+				{UserName: "{{item}}", SlotIndex: slot(1)},
+			},
+			items: []database.Item{{Name: "{{users[0]}}"}},
+			want:  "**{{users[1]}}** hit **{{item}}** with __{{users[0]}}__, **{{users[1]}}** laughs.",
+		},
+		{
+			name: "escaped names and suffixes",
+			mentions: []database.InteractionUserMention{
+				{UserName: "a_b", Suffix: "'s", SlotIndex: slot(0)},
+				{UserName: "Name#1234", SlotIndex: slot(1)},
+			},
+			items: []database.Item{{Name: "**Sword**"}},
+			want:  `**a\_b's** hit **Name#1234** with __\*\*Sword\*\*__, **a\_b's** laughs.`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Render(message, slots, test.mentions, test.items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderEvent(t *testing.T) {
+	message := database.InteractionMessage{ID: 1, Text: "A storm passed.", Event: "STORM"}
+	got, err := Render(message, Slots(message), []database.InteractionUserMention{
+		{UserName: "alice", SlotIndex: slot(0)},
+		{UserName: "bob", Killed: true, SlotIndex: slot(0)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// listed users are not part of the text
+	if got != message.Text {
+		t.Errorf("got %q, want %q", got, message.Text)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	message := database.InteractionMessage{ID: 1, Text: "{{users[0]}} threw {{item}} at {{users[1]}}."}
+	slots := Slots(message)
+	alice := database.InteractionUserMention{UserName: "alice", SlotIndex: slot(0)}
+	bob := database.InteractionUserMention{UserName: "bob", SlotIndex: slot(2)}
+	item := database.Item{Name: "Rock"}
+	for _, test := range []struct {
+		name     string
+		mentions []database.InteractionUserMention
+		items    []database.Item
+	}{
+		{"mention without slot", []database.InteractionUserMention{alice, {UserName: "bob"}}, []database.Item{item}},
+		{"unknown slot", []database.InteractionUserMention{alice, bob, {UserName: "carol", SlotIndex: slot(3)}}, []database.Item{item}},
+		{"user in item slot", []database.InteractionUserMention{alice, bob, {UserName: "carol", SlotIndex: slot(1)}}, []database.Item{item}},
+		{"missing user", []database.InteractionUserMention{alice}, []database.Item{item}},
+		{"two users in a slot", []database.InteractionUserMention{alice, bob, {UserName: "carol", SlotIndex: slot(2)}}, []database.Item{item}},
+		{"missing item", []database.InteractionUserMention{alice, bob}, nil},
+		{"two items", []database.InteractionUserMention{alice, bob}, []database.Item{item, item}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := Render(message, slots, test.mentions, test.items); err == nil {
+				t.Errorf("got %q, want an error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+-- Get the amount of games played and won by each player, counting all
+-- accounts of a player together. The name is the one from the player file or,
+-- for players without one, the latest username of one of their accounts.
+--
+-- name: GetWinsByPlayer :many
+SELECT
+    player_id,
+    player_name AS name,
+    COUNT(*) AS games,
+    SUM(won) AS wins
+FROM player_game_participation
+GROUP BY player_id
+ORDER BY wins DESC, games DESC;
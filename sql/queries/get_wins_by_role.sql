@@ -0,0 +1,20 @@
+-- Get the amount of games won by members of each role, judging by the roles
+-- the winner was last observed with before the game ended.
+--
+-- name: GetWinsByRole :many
+SELECT
+    ro.role_id,
+    ro.role_name,
+    COUNT(DISTINCT g.id) AS wins
+FROM games g
+JOIN user_role_observations ro
+    ON ro.user_id = g.winner_user_id AND ro.source_message_id = (
+        SELECT ro2.source_message_id
+        FROM user_role_observations ro2
+        WHERE ro2.user_id = g.winner_user_id AND ro2.time <= g.end_time
+        ORDER BY ro2.time DESC, ro2.id DESC
+        LIMIT 1
+    )
+WHERE ro.role_id IS NOT NULL
+GROUP BY ro.role_id
+ORDER BY wins DESC;